@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// AccountRole is a role assumed to read the pipelines of another account
+type AccountRole struct {
+	ARN       string
+	AccountID string
+	// Alias names the account in the feed, defaulting to the account ID from the role ARN
+	Alias string
+}
+
+// ParseAccountRole parses a role ARN, optionally preceded by an alias as in alias=arn
+func ParseAccountRole(value string) (AccountRole, error) {
+	role := AccountRole{ARN: value}
+	if i := strings.Index(value, "="); i >= 0 {
+		role = AccountRole{ARN: value[i+1:], Alias: value[:i]}
+	}
+
+	parsed, err := arn.Parse(role.ARN)
+	if err != nil {
+		return AccountRole{}, fmt.Errorf("invalid role ARN %s: %v", role.ARN, err)
+	}
+	role.AccountID = parsed.AccountID
+	if role.Alias == "" {
+		role.Alias = parsed.AccountID
+	}
+
+	return role, nil
+}
+
+// CrossAccountPipelineStateProvider provides access to the current state of the pipelines in several
+// accounts by assuming a role in each of them
+type CrossAccountPipelineStateProvider struct {
+	config      aws.Config
+	roles       []AccountRole
+	externalID  string
+	sessionName string
+	regions     []string
+	concurrency int
+	tags        bool
+}
+
+// GetPipelineState provides access to the current state of the pipelines in every account, in role order
+func (p *CrossAccountPipelineStateProvider) GetPipelineState() ([]PipelineState, error) {
+	accountStates := make([][]PipelineState, len(p.roles))
+	errs := make([]error, len(p.roles))
+	sources := make([]string, len(p.roles))
+
+	stsSvc := sts.NewFromConfig(p.config)
+
+	var wg sync.WaitGroup
+	for i, role := range p.roles {
+		sources[i] = role.ARN
+
+		wg.Add(1)
+		go func(i int, role AccountRole) {
+			defer wg.Done()
+			accountStates[i], errs[i] = p.accountProvider(stsSvc, role).GetPipelineState()
+			for j := range accountStates[i] {
+				accountStates[i][j].Account = role.Alias
+			}
+		}(i, role)
+	}
+	wg.Wait()
+
+	return mergePipelineStates(sources, accountStates, errs)
+}
+
+// GetSinglePipelineState provides access to the current state of a single pipeline in the account it belongs to
+func (p *CrossAccountPipelineStateProvider) GetSinglePipelineState(ref PipelineRef) (PipelineState, error) {
+	for _, role := range p.roles {
+		if role.AccountID != ref.AccountID {
+			continue
+		}
+
+		provider, ok := p.accountProvider(sts.NewFromConfig(p.config), role).(SinglePipelineStateProvider)
+		if !ok {
+			break
+		}
+
+		pipelineState, err := provider.GetSinglePipelineState(ref)
+		pipelineState.Account = role.Alias
+		return pipelineState, err
+	}
+
+	return PipelineState{}, ErrPipelineNotCovered
+}
+
+// accountProvider reports on the pipelines of the account using credentials from the assumed role
+func (p *CrossAccountPipelineStateProvider) accountProvider(stsSvc *sts.Client, role AccountRole) PipelineStateProvider {
+	cfg := p.config.Copy()
+	cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsSvc, role.ARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = p.sessionName
+		if p.externalID != "" {
+			o.ExternalID = aws.String(p.externalID)
+		}
+	}))
+
+	return newRegionalPipelineStateProvider(cfg, p.regions, p.concurrency, p.tags)
+}
+
+// newRegionalPipelineStateProvider reports on the given regions, or the configured region when there are none
+func newRegionalPipelineStateProvider(cfg aws.Config, regions []string, concurrency int, tags bool) PipelineStateProvider {
+	if len(regions) > 0 {
+		return &MultiRegionPipelineStateProvider{cfg, regions, concurrency, tags}
+	}
+	return &AWSPipelineStateProvider{cfg, concurrency, tags}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseAccountRole(t *testing.T) {
+	inputs := []string{
+		"arn:aws:iam::123456789012:role/ccxml",
+		"production=arn:aws:iam::123456789012:role/ccxml",
+	}
+	expectedAliases := []string{"123456789012", "production"}
+
+	for index, input := range inputs {
+		role, err := ParseAccountRole(input)
+		if err != nil {
+			t.Fatalf("ParseAccountRole(%s) returned %v", input, err)
+		}
+		if role.ARN != "arn:aws:iam::123456789012:role/ccxml" {
+			t.Errorf("ParseAccountRole(%s) ARN is %s", input, role.ARN)
+		}
+		if role.Alias != expectedAliases[index] {
+			t.Errorf("ParseAccountRole(%s) alias is %s not %s", input, role.Alias, expectedAliases[index])
+		}
+	}
+
+	_, err := ParseAccountRole("production=ccxml")
+	if err == nil {
+		t.Errorf("ParseAccountRole(production=ccxml) did not return an error")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AtomContentType is the Content-Type of the feed of transitions
+const AtomContentType = "application/atom+xml"
+
+// DefaultAtomEntries is the number of transitions kept in the feed when none is configured
+const DefaultAtomEntries = 50
+
+// Transition describes how the status of a project changed between builds
+type Transition string
+
+const (
+	// TransitionBroken is used when a project that was not failing has failed
+	TransitionBroken Transition = "broken"
+	// TransitionFixed is used when a failing project has succeeded
+	TransitionFixed Transition = "fixed"
+	// TransitionStillFailing is used when a failing project has failed again
+	TransitionStillFailing Transition = "still-failing"
+)
+
+// BuildTransition is a change in the status of a project
+type BuildTransition struct {
+	Project    Project
+	Transition Transition
+}
+
+// FindTransitions compares the projects with their previous state and returns those that were broken,
+// fixed or are still failing. A project that is still building has not finished failing again
+func FindTransitions(previous []Project, projects []Project) []BuildTransition {
+	previousProjects := make(map[string]Project, len(previous))
+	for _, project := range previous {
+		previousProjects[project.Name] = project
+	}
+
+	transitions := make([]BuildTransition, 0)
+	for _, project := range projects {
+		before, ok := previousProjects[project.Name]
+		wasFailing := ok && isFailing(before.LastBuildStatus)
+
+		switch {
+		case !wasFailing && isFailing(project.LastBuildStatus):
+			transitions = append(transitions, BuildTransition{project, TransitionBroken})
+		case wasFailing && project.LastBuildStatus == LastBuildStatusSuccess:
+			transitions = append(transitions, BuildTransition{project, TransitionFixed})
+		case wasFailing && isFailing(project.LastBuildStatus) &&
+			project.Activity != ActivityBuilding && project.LastBuildTime != before.LastBuildTime:
+			transitions = append(transitions, BuildTransition{project, TransitionStillFailing})
+		}
+	}
+
+	return transitions
+}
+
+func isFailing(status LastBuildStatus) bool {
+	return status == LastBuildStatusFailure || status == LastBuildStatusException
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+	// Projects records the state the next transitions are found from, in a namespace that feed readers ignore
+	Projects []atomProject `xml:"urn:aws-codepipeline-ccxml project"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Link     atomLink     `xml:"link"`
+	Category atomCategory `xml:"category"`
+	Summary  string       `xml:"summary,omitempty"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomProject struct {
+	Name            string          `xml:"name,attr"`
+	LastBuildStatus LastBuildStatus `xml:"lastBuildStatus,attr"`
+	LastBuildTime   string          `xml:"lastBuildTime,attr"`
+}
+
+// AtomPersistenceProvider persists an Atom feed of the transitions in the status of the projects, such
+// as those that were broken or fixed. The feed records the state of the projects that the next transitions
+// are found from, so the first write only records that state
+type AtomPersistenceProvider struct {
+	store   ObjectStore
+	name    string
+	entries int
+}
+
+// PersistProjects as the feed of transitions
+func (p *AtomPersistenceProvider) PersistProjects(projects []Project) (PersistStatus, error) {
+	var previous *atomFeed
+	content, err := p.store.ReadObject(p.name)
+	switch {
+	case errors.Is(err, ErrObjectNotFound):
+	case err != nil:
+		return "", fmt.Errorf("unable to read transitions: %v", err)
+	default:
+		previous = &atomFeed{}
+		err = xml.Unmarshal(content, previous)
+		if err != nil {
+			return "", fmt.Errorf("unable to decode transitions %s: %v", p.name, err)
+		}
+	}
+
+	b := bytes.NewBufferString(xml.Header)
+	err = xml.NewEncoder(b).Encode(buildAtomFeed(previous, projects, p.name, p.entries))
+	if err != nil {
+		return "", fmt.Errorf("unable to encode transitions: %v", err)
+	}
+
+	return p.store.WriteObject(p.name, b.Bytes(), AtomContentType, "")
+}
+
+// buildAtomFeed adds the transitions since the previous feed to its entries, newest first and up to the limit
+func buildAtomFeed(previous *atomFeed, projects []Project, name string, limit int) atomFeed {
+	if limit <= 0 {
+		limit = DefaultAtomEntries
+	}
+
+	feed := atomFeed{
+		ID:     "urn:aws-codepipeline-ccxml:transitions:" + url.PathEscape(name),
+		Title:  "Pipeline transitions",
+		Author: atomAuthor{"AWS CodePipeline"},
+	}
+
+	entries := make([]atomEntry, 0)
+	if previous != nil {
+		previousProjects := make([]Project, 0, len(previous.Projects))
+		for _, project := range previous.Projects {
+			previousProjects = append(previousProjects, Project{Name: project.Name, LastBuildStatus: project.LastBuildStatus, LastBuildTime: project.LastBuildTime})
+		}
+
+		for _, transition := range FindTransitions(previousProjects, projects) {
+			entries = append(entries, buildAtomEntry(feed.ID, transition))
+		}
+		entries = append(entries, previous.Entries...)
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	feed.Entries = entries
+
+	for _, project := range projects {
+		feed.Projects = append(feed.Projects, atomProject{project.Name, project.LastBuildStatus, project.LastBuildTime})
+		if project.LastBuildTime > feed.Updated {
+			feed.Updated = project.LastBuildTime
+		}
+	}
+	if len(entries) > 0 {
+		feed.Updated = entries[0].Updated
+	}
+
+	return feed
+}
+
+func buildAtomEntry(feedID string, transition BuildTransition) atomEntry {
+	project := transition.Project
+
+	var title string
+	switch transition.Transition {
+	case TransitionBroken:
+		title = fmt.Sprintf("%s is broken", project.Name)
+	case TransitionFixed:
+		title = fmt.Sprintf("%s is fixed", project.Name)
+	default:
+		title = fmt.Sprintf("%s is still failing", project.Name)
+	}
+
+	messages := make([]string, 0, len(project.Messages))
+	for _, message := range project.Messages {
+		messages = append(messages, message.Text)
+	}
+
+	return atomEntry{
+		ID:       fmt.Sprintf("%s:%s:%s:%s", feedID, url.PathEscape(project.Name), transition.Transition, project.LastBuildTime),
+		Title:    title,
+		Updated:  project.LastBuildTime,
+		Link:     atomLink{project.WebURL},
+		Category: atomCategory{string(transition.Transition)},
+		Summary:  strings.Join(messages, "; "),
+	}
+}
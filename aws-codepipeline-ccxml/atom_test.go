@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestFindTransitions(t *testing.T) {
+	previous := []Project{
+		Project{Name: "broken", LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-01T00:00:00Z"},
+		Project{Name: "fixed", LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-01-01T00:00:00Z"},
+		Project{Name: "still-failing", LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-01-01T00:00:00Z"},
+		Project{Name: "rebuilding", LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-01-01T00:00:00Z"},
+		Project{Name: "unchanged", LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-01-01T00:00:00Z"},
+		Project{Name: "passing", LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-01T00:00:00Z"},
+	}
+	projects := []Project{
+		Project{Name: "broken", LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-01-02T00:00:00Z"},
+		Project{Name: "fixed", LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-02T00:00:00Z"},
+		Project{Name: "still-failing", LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-01-02T00:00:00Z"},
+		Project{Name: "rebuilding", LastBuildStatus: LastBuildStatusFailure, Activity: ActivityBuilding, LastBuildTime: "2019-01-02T00:00:00Z"},
+		Project{Name: "unchanged", LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-01-01T00:00:00Z"},
+		Project{Name: "passing", LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-02T00:00:00Z"},
+		Project{Name: "new", LastBuildStatus: LastBuildStatusException, LastBuildTime: "2019-01-02T00:00:00Z"},
+	}
+
+	actual := make(map[string]Transition)
+	for _, transition := range FindTransitions(previous, projects) {
+		actual[transition.Project.Name] = transition.Transition
+	}
+
+	expected := map[string]Transition{
+		"broken":        TransitionBroken,
+		"fixed":         TransitionFixed,
+		"still-failing": TransitionStillFailing,
+		"new":           TransitionBroken,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("FindTransitions(...) is %v not %v", actual, expected)
+	}
+}
+
+func TestAtomPersistenceProvider(t *testing.T) {
+	store := &recordingObjectWriter{objects: map[string][]byte{}}
+	provider := AtomPersistenceProvider{store, "transitions.atom", 2}
+
+	readFeed := func() atomFeed {
+		var feed atomFeed
+		err := xml.Unmarshal(store.objects["transitions.atom"], &feed)
+		if err != nil {
+			t.Fatalf("failed to decode transitions: %v", err)
+		}
+		return feed
+	}
+
+	for i, step := range []struct {
+		status  LastBuildStatus
+		time    string
+		entries []string
+	}{
+		// the first write only records the state of the projects
+		{LastBuildStatusFailure, "2019-01-01T00:00:00Z", []string{}},
+		{LastBuildStatusSuccess, "2019-01-02T00:00:00Z", []string{"service is fixed"}},
+		{LastBuildStatusFailure, "2019-01-03T00:00:00Z", []string{"service is broken", "service is fixed"}},
+		{LastBuildStatusFailure, "2019-01-04T00:00:00Z", []string{"service is still failing", "service is broken"}},
+	} {
+		_, err := provider.PersistProjects([]Project{
+			Project{Name: "service", LastBuildStatus: step.status, LastBuildTime: step.time, WebURL: "https://acme.com/build"},
+		})
+		if err != nil {
+			t.Fatalf("PersistProjects(...) step %d returned %v", i, err)
+		}
+
+		feed := readFeed()
+		titles := make([]string, 0, len(feed.Entries))
+		for _, entry := range feed.Entries {
+			titles = append(titles, entry.Title)
+		}
+		if !reflect.DeepEqual(titles, step.entries) {
+			t.Errorf("PersistProjects(...) step %d entries are %v not %v", i, titles, step.entries)
+		}
+		if feed.Updated != step.time {
+			t.Errorf("PersistProjects(...) step %d updated is %s not %s", i, feed.Updated, step.time)
+		}
+	}
+
+	if store.contentType != AtomContentType {
+		t.Errorf("PersistProjects(...) wrote the feed as %s not %s", store.contentType, AtomContentType)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrUnauthenticated is returned when a request does not carry valid credentials
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden is returned when a request is not allowed however it is authenticated
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Authenticator decides whether a request may read the feed
+type Authenticator interface {
+	// Authenticate returns ErrUnauthenticated or ErrForbidden when the request may not read the feed
+	Authenticate(r *http.Request) error
+}
+
+// challenger is an Authenticator that tells clients how to authenticate
+type challenger interface {
+	challenges() []string
+}
+
+// Credential is a username and password accepted by basic authentication
+type Credential struct {
+	Username string
+	Password string
+}
+
+// ParseCredential parses a credential written as username:password
+func ParseCredential(value string) (Credential, error) {
+	i := strings.Index(value, ":")
+	if i < 1 {
+		return Credential{}, errors.New("invalid credential, expected username:password")
+	}
+	return Credential{value[:i], value[i+1:]}, nil
+}
+
+// BasicAuthenticator accepts requests using HTTP basic authentication with one of the credentials
+type BasicAuthenticator struct {
+	credentials []Credential
+}
+
+// Authenticate the request, comparing it with every credential in constant time
+func (a *BasicAuthenticator) Authenticate(r *http.Request) error {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	matched := 0
+	for _, credential := range a.credentials {
+		matched |= constantTimeEqual(username, credential.Username) & constantTimeEqual(password, credential.Password)
+	}
+	if matched != 1 {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+func (a *BasicAuthenticator) challenges() []string {
+	return []string{`Basic realm="ccxml", charset="UTF-8"`}
+}
+
+// BearerAuthenticator accepts requests carrying one of the tokens as a bearer token
+type BearerAuthenticator struct {
+	tokens []string
+}
+
+// Authenticate the request, comparing it with every token in constant time
+func (a *BearerAuthenticator) Authenticate(r *http.Request) error {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ErrUnauthenticated
+	}
+
+	matched := 0
+	for _, t := range a.tokens {
+		matched |= constantTimeEqual(strings.TrimSpace(token), t)
+	}
+	if matched != 1 {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+func (a *BearerAuthenticator) challenges() []string {
+	return []string{`Bearer realm="ccxml"`}
+}
+
+// constantTimeEqual compares hashes of the values, so the time taken does not reveal their length either
+func constantTimeEqual(a string, b string) int {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:])
+}
+
+// AnyAuthenticator accepts requests that any of its authenticators accept, such as either basic
+// authentication or a bearer token
+type AnyAuthenticator []Authenticator
+
+// Authenticate the request with each authenticator in turn
+func (a AnyAuthenticator) Authenticate(r *http.Request) error {
+	err := ErrUnauthenticated
+	for _, authenticator := range a {
+		err = authenticator.Authenticate(r)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (a AnyAuthenticator) challenges() []string {
+	challenges := make([]string, 0)
+	for _, authenticator := range a {
+		if c, ok := authenticator.(challenger); ok {
+			challenges = append(challenges, c.challenges()...)
+		}
+	}
+	return challenges
+}
+
+// CIDRAuthenticator only accepts requests from the networks. The source of a request is the address
+// it was received from, which behind a load balancer is the load balancer
+type CIDRAuthenticator struct {
+	networks []*net.IPNet
+}
+
+// ParseCIDRs parses a list of networks in CIDR notation, treating a bare address as a network of one
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid CIDR %s", value)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s: %v", value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Authenticate the request by its source address
+func (a *CIDRAuthenticator) Authenticate(r *http.Request) error {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// requests received by a Lambda have no port
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ErrForbidden
+	}
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+// withAuthentication only passes on requests that every authenticator accepts. The responses to other
+// requests say nothing about the feed, such as the names of the pipelines
+func withAuthentication(handler http.Handler, authenticators []Authenticator) http.Handler {
+	if len(authenticators) == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, authenticator := range authenticators {
+			err := authenticator.Authenticate(r)
+			if errors.Is(err, ErrForbidden) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				if c, ok := authenticator.(challenger); ok {
+					for _, challenge := range c.challenges() {
+						w.Header().Add("WWW-Authenticate", challenge)
+					}
+				}
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// readLines reads the non-empty lines of a file, such as one holding credentials or tokens
+func readLines(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s: %v", filename, err)
+	}
+	defer f.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read file %s: %v", filename, err)
+	}
+	return lines, nil
+}
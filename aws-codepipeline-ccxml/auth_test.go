@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestWithAuthentication(t *testing.T) {
+	networks, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("ParseCIDRs(...) returned %v", err)
+	}
+
+	server := &FeedServer{authenticators: []Authenticator{
+		&CIDRAuthenticator{networks},
+		AnyAuthenticator{
+			&BasicAuthenticator{[]Credential{Credential{"nevergreen", "secret"}}},
+			&BearerAuthenticator{[]string{"token"}},
+		},
+	}}
+	server.PersistProjects([]Project{
+		Project{Name: "prod :: service", Activity: ActivitySleeping, LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-01T00:00:00Z"},
+	})
+	handler := server.Handler()
+
+	for _, test := range []struct {
+		name       string
+		remoteAddr string
+		username   string
+		password   string
+		token      string
+		code       int
+	}{
+		{"basic", "10.1.2.3:1234", "nevergreen", "secret", "", http.StatusOK},
+		{"bearer", "10.1.2.3:1234", "", "", "token", http.StatusOK},
+		{"single address", "192.168.1.1:1234", "", "", "token", http.StatusOK},
+		{"no credentials", "10.1.2.3:1234", "", "", "", http.StatusUnauthorized},
+		{"wrong password", "10.1.2.3:1234", "nevergreen", "wrong", "", http.StatusUnauthorized},
+		{"wrong username", "10.1.2.3:1234", "other", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "10.1.2.3:1234", "", "", "wrong", http.StatusUnauthorized},
+		{"other network", "172.16.0.1:1234", "nevergreen", "secret", "", http.StatusForbidden},
+		{"other address", "192.168.1.2:1234", "", "", "token", http.StatusForbidden},
+	} {
+		request := httptest.NewRequest("GET", "/cc.xml", nil)
+		request.RemoteAddr = test.remoteAddr
+		if test.username != "" {
+			request.SetBasicAuth(test.username, test.password)
+		}
+		if test.token != "" {
+			request.Header.Set("Authorization", "Bearer "+test.token)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: GET /cc.xml is %d not %d", test.name, recorder.Code, test.code)
+			continue
+		}
+		if test.code == http.StatusOK {
+			continue
+		}
+		if strings.Contains(recorder.Body.String(), "service") {
+			t.Errorf("%s: GET /cc.xml response names the pipeline: %s", test.name, recorder.Body.String())
+		}
+		challenges := recorder.Header().Values("WWW-Authenticate")
+		if test.code == http.StatusUnauthorized && len(challenges) != 2 {
+			t.Errorf("%s: GET /cc.xml WWW-Authenticate is %v", test.name, challenges)
+		}
+		if test.code == http.StatusForbidden && len(challenges) != 0 {
+			t.Errorf("%s: GET /cc.xml WWW-Authenticate is %v", test.name, challenges)
+		}
+	}
+}
+
+func TestHandleFunctionURLAuthentication(t *testing.T) {
+	networks, _ := ParseCIDRs([]string{"203.0.113.0/24"})
+	server := newTestFeedServer()
+	server.authenticators = []Authenticator{&CIDRAuthenticator{networks}}
+
+	for _, test := range []struct {
+		sourceIP string
+		code     int
+	}{
+		{"203.0.113.10", http.StatusOK},
+		{"198.51.100.10", http.StatusForbidden},
+	} {
+		request := events.LambdaFunctionURLRequest{RawPath: "/cc.xml"}
+		request.RequestContext.HTTP.Method = "GET"
+		request.RequestContext.HTTP.SourceIP = test.sourceIP
+		response, err := server.HandleFunctionURL(context.Background(), request)
+		if err != nil {
+			t.Fatalf("HandleFunctionURL(...) returned %v", err)
+		}
+
+		if response.StatusCode != test.code {
+			t.Errorf("HandleFunctionURL(...) from %s status is %d not %d", test.sourceIP, response.StatusCode, test.code)
+		}
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	_, err := ParseCIDRs([]string{"10.0.0.0/33"})
+	if err == nil {
+		t.Error("ParseCIDRs([10.0.0.0/33]) did not return an error")
+	}
+	_, err = ParseCIDRs([]string{"example.com"})
+	if err == nil {
+		t.Error("ParseCIDRs([example.com]) did not return an error")
+	}
+
+	networks, err := ParseCIDRs([]string{"2001:db8::1"})
+	if err != nil {
+		t.Fatalf("ParseCIDRs([2001:db8::1]) returned %v", err)
+	}
+	if networks[0].String() != "2001:db8::1/128" {
+		t.Errorf("ParseCIDRs([2001:db8::1]) is %s not 2001:db8::1/128", networks[0])
+	}
+}
+
+func TestParseCredential(t *testing.T) {
+	credential, err := ParseCredential("nevergreen:pass:word")
+	if err != nil {
+		t.Fatalf("ParseCredential(...) returned %v", err)
+	}
+	if !reflect.DeepEqual(credential, Credential{"nevergreen", "pass:word"}) {
+		t.Errorf("ParseCredential(...) is %v", credential)
+	}
+
+	_, err = ParseCredential(":password")
+	if err == nil {
+		t.Error("ParseCredential(:password) did not return an error")
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "tokens")
+	err := os.WriteFile(filename, []byte("# tokens\none\n\n  two  \n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := readLines(filename)
+	if err != nil {
+		t.Fatalf("readLines(...) returned %v", err)
+	}
+	if !reflect.DeepEqual(lines, []string{"one", "two"}) {
+		t.Errorf("readLines(...) is %v", lines)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode/utf8"
+)
+
+// BadgeContentType is the Content-Type of a badge
+const BadgeContentType = "image/svg+xml"
+
+// DefaultBadgeCacheControl keeps badges fresh in READMEs, which are served through caching proxies
+const DefaultBadgeCacheControl = "max-age=60, must-revalidate"
+
+// BadgePersistenceProvider persists an SVG status badge for each project under a prefix
+type BadgePersistenceProvider struct {
+	writer       ObjectWriter
+	prefix       string
+	cacheControl string
+	// concurrency is the number of badges written at the same time
+	concurrency int
+}
+
+// PersistProjects as a badge each, returning a *MultiTargetError recording the badges that could not be written
+func (p *BadgePersistenceProvider) PersistProjects(projects []Project) (PersistStatus, error) {
+	statuses := make([]PersistStatus, len(projects))
+	errs := make([]error, len(projects))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers(p.concurrency, len(projects)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				statuses[i], errs[i] = p.persistBadge(projects[i])
+			}
+		}()
+	}
+	for i := range projects {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	status := PersistStatusUnchanged
+	failed := make([]*TargetError, 0)
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, &TargetError{p.badgeName(projects[i]), err})
+		} else if statuses[i] == PersistStatusWritten {
+			status = PersistStatusWritten
+		}
+	}
+
+	if len(failed) > 0 {
+		return "", &MultiTargetError{failed, len(projects)}
+	}
+	return status, nil
+}
+
+func (p *BadgePersistenceProvider) persistBadge(project Project) (PersistStatus, error) {
+	var b bytes.Buffer
+	err := RenderBadge(project, &b)
+	if err != nil {
+		return "", fmt.Errorf("unable to render badge: %v", err)
+	}
+
+	cacheControl := p.cacheControl
+	if cacheControl == "" {
+		cacheControl = DefaultBadgeCacheControl
+	}
+	return p.writer.WriteObject(p.badgeName(project), b.Bytes(), BadgeContentType, cacheControl)
+}
+
+var unsafeBadgeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// badgeName is the key or file name of the badge of a project, with the separators
+// and any other characters that are awkward in URLs replaced by dashes
+func (p *BadgePersistenceProvider) badgeName(project Project) string {
+	return p.prefix + strings.Trim(unsafeBadgeName.ReplaceAllString(project.Name, "-"), "-") + ".svg"
+}
+
+// Badge colours, matching those of shields.io
+const (
+	badgeColourLabel   = "#555"
+	badgeColourSuccess = "#4c1"
+	badgeColourFailure = "#e05d44"
+	badgeColourUnknown = "#9f9f9f"
+)
+
+// badgeCharWidth and badgePadding approximate the width of the 11px Verdana text of a badge
+const (
+	badgeCharWidth = 7
+	badgePadding   = 10
+)
+
+var badgeTemplate = template.Must(template.New("badge").Funcs(template.FuncMap{
+	"escape": template.HTMLEscapeString,
+}).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{escape .Label}}: {{escape .Message}}">` +
+	`<title>{{escape .Label}}: {{escape .Message}}</title>` +
+	`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+	`<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>` +
+	`<g clip-path="url(#r)"><rect width="{{.LabelWidth}}" height="20" fill="{{.LabelColour}}"/><rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Colour}}"/><rect width="{{.Width}}" height="20" fill="url(#s)"/></g>` +
+	`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` +
+	`<text x="{{.LabelX}}" y="14">{{escape .Label}}</text><text x="{{.MessageX}}" y="14">{{escape .Message}}</text></g></svg>`))
+
+type badge struct {
+	Label        string
+	Message      string
+	LabelColour  string
+	Colour       string
+	LabelWidth   int
+	MessageWidth int
+}
+
+func (b badge) Width() int {
+	return b.LabelWidth + b.MessageWidth
+}
+
+func (b badge) LabelX() int {
+	return b.LabelWidth / 2
+}
+
+func (b badge) MessageX() int {
+	return b.LabelWidth + b.MessageWidth/2
+}
+
+// RenderBadge renders a shields style SVG badge labelled with the project name and giving its status,
+// which notes when the project is building
+func RenderBadge(project Project, w io.Writer) error {
+	message := strings.ToLower(string(project.LastBuildStatus))
+	if project.Activity == ActivityBuilding {
+		message += ", building"
+	}
+
+	return badgeTemplate.Execute(w, badge{
+		Label:        project.Name,
+		Message:      message,
+		LabelColour:  badgeColourLabel,
+		Colour:       badgeColour(project.LastBuildStatus),
+		LabelWidth:   badgeTextWidth(project.Name),
+		MessageWidth: badgeTextWidth(message),
+	})
+}
+
+func badgeColour(status LastBuildStatus) string {
+	switch status {
+	case LastBuildStatusSuccess:
+		return badgeColourSuccess
+	case LastBuildStatusFailure, LastBuildStatusException:
+		return badgeColourFailure
+	}
+	return badgeColourUnknown
+}
+
+func badgeTextWidth(text string) int {
+	return utf8.RuneCountInString(text)*badgeCharWidth + badgePadding
+}
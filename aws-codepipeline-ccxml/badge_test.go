@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingObjectWriter struct {
+	mu           sync.Mutex
+	objects      map[string][]byte
+	contentType  string
+	cacheControl string
+	err          error
+}
+
+func (w *recordingObjectWriter) WriteObject(name string, content []byte, contentType string, cacheControl string) (PersistStatus, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return "", w.err
+	}
+	w.objects[name] = content
+	w.contentType = contentType
+	w.cacheControl = cacheControl
+	return PersistStatusWritten, nil
+}
+
+func (w *recordingObjectWriter) ReadObject(name string) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	content, ok := w.objects[name]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return content, nil
+}
+
+func TestRenderBadge(t *testing.T) {
+	for _, test := range []struct {
+		project Project
+		message string
+		colour  string
+	}{
+		{Project{Name: "service", LastBuildStatus: LastBuildStatusSuccess, Activity: ActivitySleeping}, "success", badgeColourSuccess},
+		{Project{Name: "service", LastBuildStatus: LastBuildStatusFailure, Activity: ActivityBuilding}, "failure, building", badgeColourFailure},
+		{Project{Name: "service", LastBuildStatus: LastBuildStatusUnknown, Activity: ActivitySleeping}, "unknown", badgeColourUnknown},
+	} {
+		var b bytes.Buffer
+		err := RenderBadge(test.project, &b)
+		if err != nil {
+			t.Fatalf("RenderBadge(...) returned %v", err)
+		}
+
+		svg := b.String()
+		if !strings.Contains(svg, ">service</text>") || !strings.Contains(svg, ">"+test.message+"</text>") {
+			t.Errorf("RenderBadge(...) does not show %s: %s", test.message, svg)
+		}
+		if !strings.Contains(svg, `fill="`+test.colour+`"`) {
+			t.Errorf("RenderBadge(...) is not coloured %s: %s", test.colour, svg)
+		}
+	}
+}
+
+func TestRenderBadgeEscapesName(t *testing.T) {
+	var b bytes.Buffer
+	err := RenderBadge(Project{Name: `<service & "friends">`, LastBuildStatus: LastBuildStatusSuccess}, &b)
+	if err != nil {
+		t.Fatalf("RenderBadge(...) returned %v", err)
+	}
+
+	err = xml.Unmarshal(b.Bytes(), new(struct{}))
+	if err != nil {
+		t.Errorf("RenderBadge(...) is not valid XML: %v", err)
+	}
+}
+
+func TestBadgePersistenceProvider(t *testing.T) {
+	writer := &recordingObjectWriter{objects: map[string][]byte{}}
+	provider := BadgePersistenceProvider{writer, "badges/", "", 2}
+
+	status, err := provider.PersistProjects([]Project{
+		Project{Name: "prod :: service-a", LastBuildStatus: LastBuildStatusSuccess},
+		Project{Name: "service/b", LastBuildStatus: LastBuildStatusFailure},
+	})
+	if err != nil {
+		t.Fatalf("PersistProjects(...) returned %v", err)
+	}
+	if status != PersistStatusWritten {
+		t.Errorf("PersistProjects(...) status is %s not %s", status, PersistStatusWritten)
+	}
+
+	for _, name := range []string{"badges/prod-service-a.svg", "badges/service-b.svg"} {
+		if _, ok := writer.objects[name]; !ok {
+			t.Errorf("PersistProjects(...) did not write %s", name)
+		}
+	}
+	if writer.contentType != BadgeContentType || writer.cacheControl != DefaultBadgeCacheControl {
+		t.Errorf("PersistProjects(...) wrote badges as %s with %s", writer.contentType, writer.cacheControl)
+	}
+
+	writer.err = errors.New("AccessDenied")
+	_, err = provider.PersistProjects([]Project{Project{Name: "service"}})
+	var targetErr *MultiTargetError
+	if !errors.As(err, &targetErr) || targetErr.Errs[0].Target != "badges/service.svg" {
+		t.Errorf("PersistProjects(...) returned %v not the failed badge", err)
+	}
+}
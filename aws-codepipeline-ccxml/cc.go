@@ -1,21 +1,72 @@
 package main
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"io"
+	"path"
+	"strings"
 )
 
 // Specification at: https://github.com/robertmaldon/cc_dashboard#summary
 
 // Project represents a phase in a build pipeline that is reported on
 type Project struct {
-	Name            string          `xml:"name,attr"`
-	Activity        Activity        `xml:"activity,attr"`
-	LastBuildLabel  string          `xml:"lastBuildLabel,attr,omitempty"`
-	LastBuildStatus LastBuildStatus `xml:"lastBuildStatus,attr"`
-	LastBuildTime   string          `xml:"lastBuildTime,attr"`
-	NextBuildTime   string          `xml:"nextBuildTime,attr,omitempty"`
-	WebURL          string          `xml:"webUrl,attr"`
+	Name            string          `xml:"name,attr" json:"name"`
+	Activity        Activity        `xml:"activity,attr" json:"activity"`
+	LastBuildLabel  string          `xml:"lastBuildLabel,attr,omitempty" json:"lastBuildLabel,omitempty"`
+	LastBuildStatus LastBuildStatus `xml:"lastBuildStatus,attr" json:"lastBuildStatus"`
+	LastBuildTime   string          `xml:"lastBuildTime,attr" json:"lastBuildTime"`
+	NextBuildTime   string          `xml:"nextBuildTime,attr,omitempty" json:"nextBuildTime,omitempty"`
+	WebURL          string          `xml:"webUrl,attr" json:"webUrl"`
+	Messages        Messages        `xml:"messages,omitempty" json:"messages,omitempty"`
+
+	// the fields below are not part of the CCTray specification and are only published as JSON
+	Pipeline    string  `xml:"-" json:"pipeline,omitempty"`
+	Region      string  `xml:"-" json:"region,omitempty"`
+	Account     string  `xml:"-" json:"account,omitempty"`
+	ExecutionID string  `xml:"-" json:"executionId,omitempty"`
+	Stages      []Stage `xml:"-" json:"stages,omitempty"`
+	// Tags are those of the pipeline, when they are read
+	Tags map[string]string `xml:"-" json:"tags,omitempty"`
+}
+
+// Stage breaks down the status of a pipeline Project by stage
+type Stage struct {
+	Name            string          `json:"name"`
+	Activity        Activity        `json:"activity"`
+	LastBuildStatus LastBuildStatus `json:"lastBuildStatus"`
+	LastBuildTime   string          `json:"lastBuildTime"`
+	ExecutionID     string          `json:"executionId,omitempty"`
+}
+
+// Messages are encoded within a messages element, which is left out when there are none
+type Messages []Message
+
+type messagesContainer struct {
+	Messages []Message `xml:"message"`
+}
+
+// MarshalXML encodes the messages as message elements within the start element
+func (m Messages) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(messagesContainer{m}, start)
+}
+
+// UnmarshalXML decodes the message elements within the start element
+func (m *Messages) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var container messagesContainer
+	err := d.DecodeElement(&container, &start)
+	if err != nil {
+		return err
+	}
+	*m = container.Messages
+	return nil
+}
+
+// Message provides additional information about a project, as supported by CCTray clients
+type Message struct {
+	Text string      `xml:"text,attr" json:"text"`
+	Kind MessageKind `xml:"kind,attr,omitempty" json:"kind,omitempty"`
 }
 
 type projectsContainer struct {
@@ -28,6 +79,16 @@ func Encode(projects []Project, w io.Writer) error {
 	return xml.NewEncoder(w).Encode(projectsContainer{Projects: projects})
 }
 
+// Decode projects previously encoded as XML
+func Decode(r io.Reader) ([]Project, error) {
+	var container projectsContainer
+	err := xml.NewDecoder(r).Decode(&container)
+	if err != nil {
+		return nil, err
+	}
+	return container.Projects, nil
+}
+
 // LastBuildStatus describes the status of the most recent build
 type LastBuildStatus string
 
@@ -42,6 +103,67 @@ const (
 	LastBuildStatusUnknown LastBuildStatus = "Unknown"
 )
 
+type jsonProjectsContainer struct {
+	Projects []Project `json:"projects"`
+}
+
+// EncodeJSON encodes the projects as JSON, including the fields outside the CCTray specification
+func EncodeJSON(projects []Project, w io.Writer) error {
+	return json.NewEncoder(w).Encode(jsonProjectsContainer{Projects: projects})
+}
+
+// DecodeJSON decodes projects previously encoded as JSON
+func DecodeJSON(r io.Reader) ([]Project, error) {
+	var container jsonProjectsContainer
+	err := json.NewDecoder(r).Decode(&container)
+	if err != nil {
+		return nil, err
+	}
+	return container.Projects, nil
+}
+
+// Format describes how a feed is encoded
+type Format string
+
+const (
+	// FormatXML is the CCTray XML feed
+	FormatXML Format = "xml"
+	// FormatJSON is the JSON feed with the additional fields
+	FormatJSON Format = "json"
+)
+
+// FormatOf returns the format of a feed from its file name or key, which is XML unless it has a .json extension
+func FormatOf(name string) Format {
+	if path.Ext(strings.TrimSuffix(name, ".gz")) == ".json" {
+		return FormatJSON
+	}
+	return FormatXML
+}
+
+// ContentType of a feed in the format
+func (f Format) ContentType() string {
+	if f == FormatJSON {
+		return "application/json"
+	}
+	return "application/xml"
+}
+
+// EncodeFormat encodes the projects in the format
+func EncodeFormat(projects []Project, w io.Writer, format Format) error {
+	if format == FormatJSON {
+		return EncodeJSON(projects, w)
+	}
+	return Encode(projects, w)
+}
+
+// DecodeFormat decodes projects previously encoded in the format
+func DecodeFormat(r io.Reader, format Format) ([]Project, error) {
+	if format == FormatJSON {
+		return DecodeJSON(r)
+	}
+	return Decode(r)
+}
+
 // Activity describes the current status of a build
 type Activity string
 
@@ -53,3 +175,11 @@ const (
 	// ActivityCheckingModifications is the string used to indicate that the project is checking for modifications
 	ActivityCheckingModifications Activity = "CheckingModifications"
 )
+
+// MessageKind describes the type of information a message provides
+type MessageKind string
+
+const (
+	// MessageKindBuildStatus is the string used to indicate that the message describes the status of the build
+	MessageKindBuildStatus MessageKind = "BuildStatus"
+)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeMessages(t *testing.T) {
+	projects := []Project{
+		Project{
+			Name:            "test-project",
+			Activity:        ActivitySleeping,
+			LastBuildStatus: LastBuildStatusUnknown,
+			LastBuildTime:   "2019-01-01T00:00:00Z",
+			WebURL:          "https://acme.com/build",
+			Messages:        []Message{Message{Text: "Transition to production disabled", Kind: MessageKindBuildStatus}},
+		},
+	}
+
+	var b bytes.Buffer
+	err := Encode(projects, &b)
+	if err != nil {
+		t.Fatalf("failed to encode projects: %v", err)
+	}
+
+	expected := `<Projects><Project name="test-project" activity="Sleeping" lastBuildStatus="Unknown" lastBuildTime="2019-01-01T00:00:00Z" webUrl="https://acme.com/build"><messages><message text="Transition to production disabled" kind="BuildStatus"></message></messages></Project></Projects>`
+	if b.String() != expected {
+		t.Errorf(`strings did not match: got "%s" expected "%s"`, b.String(), expected)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	input := `<Projects><Project name="test-project" activity="Building" lastBuildStatus="Success" lastBuildTime="2019-01-01T00:00:00Z" webUrl="https://acme.com/build"></Project></Projects>`
+
+	projects, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("failed to decode projects: %v", err)
+	}
+
+	var b bytes.Buffer
+	err = Encode(projects, &b)
+	if err != nil {
+		t.Fatalf("failed to encode projects: %v", err)
+	}
+	if b.String() != input {
+		t.Errorf(`strings did not match: got "%s" expected "%s"`, b.String(), input)
+	}
+
+	_, err = Decode(strings.NewReader("<Projects><Project"))
+	if err == nil {
+		t.Errorf("Decode(...) of a truncated feed did not return an error")
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	projects := []Project{
+		Project{
+			Name:            "test-project",
+			Activity:        ActivitySleeping,
+			LastBuildStatus: LastBuildStatusSuccess,
+			LastBuildTime:   "2019-01-01T00:00:00Z",
+			WebURL:          "https://acme.com/build",
+			Region:          "eu-west-1",
+			ExecutionID:     "execution",
+			Stages:          []Stage{Stage{Name: "build", Activity: ActivitySleeping, LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-01T00:00:00Z"}},
+		},
+	}
+
+	var b bytes.Buffer
+	err := EncodeJSON(projects, &b)
+	if err != nil {
+		t.Fatalf("failed to encode projects: %v", err)
+	}
+
+	expected := `{"projects":[{"name":"test-project","activity":"Sleeping","lastBuildStatus":"Success","lastBuildTime":"2019-01-01T00:00:00Z","webUrl":"https://acme.com/build","region":"eu-west-1","executionId":"execution","stages":[{"name":"build","activity":"Sleeping","lastBuildStatus":"Success","lastBuildTime":"2019-01-01T00:00:00Z"}]}]}` + "\n"
+	if b.String() != expected {
+		t.Errorf(`strings did not match: got "%s" expected "%s"`, b.String(), expected)
+	}
+
+	decoded, err := DecodeJSON(&b)
+	if err != nil {
+		t.Fatalf("failed to decode projects: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, projects) {
+		t.Errorf("DecodeJSON(...) is %v not %v", decoded, projects)
+	}
+
+	// the fields outside the CCTray specification are left out of the XML feed
+	b.Reset()
+	err = Encode(projects, &b)
+	if err != nil {
+		t.Fatalf("failed to encode projects: %v", err)
+	}
+	if strings.Contains(b.String(), "eu-west-1") || strings.Contains(b.String(), "execution") {
+		t.Errorf("Encode(...) included fields outside the CCTray specification: %s", b.String())
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for name, expected := range map[string]Format{
+		"cc.xml":           FormatXML,
+		"feeds/cc.json":    FormatJSON,
+		"/var/www/cc.json": FormatJSON,
+		"cc.json.gz":       FormatJSON,
+		"cc":               FormatXML,
+	} {
+		if actual := FormatOf(name); actual != expected {
+			t.Errorf("FormatOf(%s) is %s not %s", name, actual, expected)
+		}
+	}
+}
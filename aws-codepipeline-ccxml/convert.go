@@ -2,51 +2,366 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
 )
 
+// Granularity describes how much of a pipeline each Project reports on
+type Granularity string
+
+const (
+	// GranularityPipeline reports a single Project for each pipeline
+	GranularityPipeline Granularity = "pipeline"
+	// GranularityStage reports a Project for each stage of a pipeline
+	GranularityStage Granularity = "stage"
+	// GranularityAction reports a Project for each action within each stage of a pipeline
+	GranularityAction Granularity = "action"
+)
+
+// DefaultSeparator is placed between the pipeline, stage and action names of a Project
+const DefaultSeparator = " :: "
+
+// TransitionTreatment describes how stages behind a disabled transition are reported
+type TransitionTreatment string
+
+const (
+	// TransitionTreatmentIgnore reports stages behind a disabled transition as normal
+	TransitionTreatmentIgnore TransitionTreatment = "ignore"
+	// TransitionTreatmentUnknown reports stages behind a disabled transition with an Unknown status
+	// and a message explaining who disabled the transition and why
+	TransitionTreatmentUnknown TransitionTreatment = "unknown"
+)
+
+// NamePlacement describes where a qualifier, such as the region or account, is placed in the name of a Project
+type NamePlacement string
+
+const (
+	// NamePlacementNone leaves the qualifier out of the name of a Project
+	NamePlacementNone NamePlacement = "none"
+	// NamePlacementPrefix places the qualifier before the pipeline name
+	NamePlacementPrefix NamePlacement = "prefix"
+	// NamePlacementSuffix places the qualifier after the pipeline name
+	NamePlacementSuffix NamePlacement = "suffix"
+)
+
+// ConvertOptions controls how pipeline states are converted to Projects
+type ConvertOptions struct {
+	Granularity         Granularity
+	Separator           string
+	DisabledTransitions TransitionTreatment
+	RegionNaming        NamePlacement
+	AccountNaming       NamePlacement
+}
+
 // Convert the pipeline states to Projects
-func Convert(pipelineStates []PipelineState) []Project {
+func Convert(pipelineStates []PipelineState, options ConvertOptions) []Project {
 	projects := make([]Project, 0)
 
 	for _, pipeline := range pipelineStates {
-		lastBuildStatus := LastBuildStatusSuccess
-		activity := ActivitySleeping
-		var lastBuildTime time.Time
-
-		// 检查所有阶段的状态
-		for _, stage := range pipeline.StageStates {
-			stageStatus := buildLastBuildStatus(stage)
-			if stageStatus == LastBuildStatusFailure {
-				lastBuildStatus = LastBuildStatusFailure
-			}
-
-			stageActivity := buildActivity(stage)
-			if stageActivity == ActivityBuilding {
-				activity = ActivityBuilding
-			}
-
-			// 获取最新的构建时间
-			stageTime := getStageTime(pipeline.Created, stage)
-			if stageTime.After(lastBuildTime) {
-				lastBuildTime = stageTime
-			}
+		if pipeline.Err != nil {
+			projects = append(projects, convertUnreadable(pipeline, options))
+			continue
+		}
+
+		switch options.Granularity {
+		case GranularityStage:
+			projects = append(projects, convertStages(pipeline, options)...)
+		case GranularityAction:
+			projects = append(projects, convertActions(pipeline, options)...)
+		default:
+			projects = append(projects, convertPipeline(pipeline, options))
+		}
+	}
+
+	return projects
+}
+
+// convertUnreadable reports a pipeline whose state could not be read as a single Unknown project
+func convertUnreadable(pipeline PipelineState, options ConvertOptions) Project {
+	return Project{
+		Name:            pipelineName(pipeline, options),
+		LastBuildStatus: LastBuildStatusUnknown,
+		Activity:        ActivitySleeping,
+		LastBuildTime:   pipeline.Created.Format(time.RFC3339),
+		WebURL:          buildWebURL(pipeline),
+		Messages:        []Message{Message{Text: "Unable to read pipeline state", Kind: MessageKindBuildStatus}},
+		Pipeline:        pipeline.Name,
+		Region:          pipeline.Region,
+		Account:         pipeline.Account,
+		Tags:            pipeline.Tags,
+	}
+}
+
+func convertPipeline(pipeline PipelineState, options ConvertOptions) Project {
+	lastBuildStatus := LastBuildStatusSuccess
+	activity := ActivitySleeping
+	var lastBuildTime time.Time
+	var executionID string
+	var messages []Message
+
+	// 检查所有阶段的状态
+	for _, stage := range pipeline.StageStates {
+		stageStatus := stageLastBuildStatus(pipeline, stage)
+		if stageStatus == LastBuildStatusFailure {
+			lastBuildStatus = LastBuildStatusFailure
+		}
+
+		stageActivity := buildActivity(stage)
+		if stageActivity == ActivityBuilding {
+			activity = ActivityBuilding
+		}
+
+		// 获取最新的构建时间
+		stageTime := getStageTime(pipeline.Created, stage)
+		if stageTime.After(lastBuildTime) {
+			lastBuildTime = stageTime
+			executionID = stageExecutionID(stage)
+		}
+
+		if isTransitionTreated(stage, options) {
+			messages = append(messages, buildTransitionMessage(stage))
+		}
+	}
+
+	// a failure remains visible even when a later stage has been frozen
+	if len(messages) > 0 && lastBuildStatus != LastBuildStatusFailure {
+		lastBuildStatus = LastBuildStatusUnknown
+	}
+
+	return Project{
+		Name:            pipelineName(pipeline, options),
+		LastBuildStatus: lastBuildStatus,
+		Activity:        activity,
+		LastBuildTime:   lastBuildTime.Format(time.RFC3339),
+		WebURL:          buildWebURL(pipeline),
+		Messages:        messages,
+		Pipeline:        pipeline.Name,
+		Region:          pipeline.Region,
+		Account:         pipeline.Account,
+		Tags:            pipeline.Tags,
+		ExecutionID:     executionID,
+		Stages:          convertStageBreakdown(pipeline, options),
+	}
+}
+
+// convertStageBreakdown summarises each stage of a pipeline Project for the JSON feed
+func convertStageBreakdown(pipeline PipelineState, options ConvertOptions) []Stage {
+	stages := make([]Stage, 0, len(pipeline.StageStates))
+
+	for _, stage := range pipeline.StageStates {
+		lastBuildStatus := stageLastBuildStatus(pipeline, stage)
+		if isTransitionTreated(stage, options) {
+			lastBuildStatus = LastBuildStatusUnknown
 		}
 
-		projects = append(projects, Project{
-			Name:            pipeline.Name,
+		stages = append(stages, Stage{
+			Name:            stageName(stage),
+			Activity:        buildActivity(stage),
 			LastBuildStatus: lastBuildStatus,
-			Activity:        activity,
-			LastBuildTime:   lastBuildTime.Format(time.RFC3339),
-			WebURL:         fmt.Sprintf("https://%s.console.aws.amazon.com/codesuite/codepipeline/pipelines/%s/view", pipeline.Region, pipeline.Name),
+			LastBuildTime:   buildLastBuildTime(pipeline.Created, stage),
+			ExecutionID:     stageExecutionID(stage),
 		})
 	}
 
+	return stages
+}
+
+func convertStages(pipeline PipelineState, options ConvertOptions) []Project {
+	projects := make([]Project, 0, len(pipeline.StageStates))
+
+	for _, stage := range pipeline.StageStates {
+		projects = append(projects, applyTransition(Project{
+			Name:            buildName(options.Separator, pipelineName(pipeline, options), stageName(stage)),
+			LastBuildStatus: stageLastBuildStatus(pipeline, stage),
+			Activity:        buildActivity(stage),
+			LastBuildTime:   buildLastBuildTime(pipeline.Created, stage),
+			WebURL:          buildWebURL(pipeline),
+			Pipeline:        pipeline.Name,
+			Region:          pipeline.Region,
+			Account:         pipeline.Account,
+			Tags:            pipeline.Tags,
+			ExecutionID:     stageExecutionID(stage),
+		}, stage, options))
+	}
+
+	return projects
+}
+
+func convertActions(pipeline PipelineState, options ConvertOptions) []Project {
+	projects := make([]Project, 0)
+
+	for _, stage := range pipeline.StageStates {
+		for _, action := range stage.ActionStates {
+			projects = append(projects, applyTransition(Project{
+				Name:            buildName(options.Separator, pipelineName(pipeline, options), stageName(stage), actionName(action)),
+				LastBuildStatus: actionLastBuildStatus(pipeline, stage, action),
+				Activity:        buildActionActivity(action),
+				LastBuildTime:   buildActionLastBuildTime(pipeline.Created, action),
+				WebURL:          buildActionWebURL(pipeline, action),
+				Pipeline:        pipeline.Name,
+				Region:          pipeline.Region,
+				Account:         pipeline.Account,
+				Tags:            pipeline.Tags,
+				ExecutionID:     stageExecutionID(stage),
+			}, stage, options))
+		}
+	}
+
 	return projects
 }
 
+// isTransitionTreated is true when the stage sits behind a disabled transition that should be reported
+func isTransitionTreated(stage types.StageState, options ConvertOptions) bool {
+	return options.DisabledTransitions == TransitionTreatmentUnknown &&
+		stage.InboundTransitionState != nil && !stage.InboundTransitionState.Enabled
+}
+
+// applyTransition marks a project as Unknown when its stage is behind a disabled transition
+func applyTransition(project Project, stage types.StageState, options ConvertOptions) Project {
+	if !isTransitionTreated(stage, options) {
+		return project
+	}
+
+	project.LastBuildStatus = LastBuildStatusUnknown
+	project.Messages = append(project.Messages, buildTransitionMessage(stage))
+	return project
+}
+
+func buildTransitionMessage(stage types.StageState) Message {
+	text := fmt.Sprintf("Transition to %s disabled", stageName(stage))
+
+	transition := stage.InboundTransitionState
+	if transition.LastChangedBy != nil {
+		text += fmt.Sprintf(" by %s", *transition.LastChangedBy)
+	}
+	if transition.DisabledReason != nil && *transition.DisabledReason != "" {
+		text += fmt.Sprintf(": %s", *transition.DisabledReason)
+	}
+
+	return Message{Text: text, Kind: MessageKindBuildStatus}
+}
+
+// ReplacePipelineProjects replaces the projects of a single pipeline within previously converted projects,
+// keeping the position of the pipeline or appending it when it is new. Passing no replacement removes the pipeline
+func ReplacePipelineProjects(existing []Project, pipeline PipelineState, replacement []Project, options ConvertOptions) []Project {
+	projects := make([]Project, 0, len(existing)+len(replacement))
+	replaced := false
+	for _, project := range existing {
+		if !isPipelineProject(project, pipeline, options) {
+			projects = append(projects, project)
+			continue
+		}
+		if !replaced {
+			projects = append(projects, replacement...)
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		projects = append(projects, replacement...)
+	}
+
+	return projects
+}
+
+// isPipelineProject is true when the project reports on the pipeline. Projects read back from an XML feed
+// do not record their pipeline, so are matched by name, and as a separator may also appear in pipeline
+// names, such as a dash, only names with as many further parts as the granularity gives are matched
+func isPipelineProject(project Project, pipeline PipelineState, options ConvertOptions) bool {
+	if project.Pipeline != "" {
+		return project.Pipeline == pipeline.Name && project.Region == pipeline.Region && project.Account == pipeline.Account
+	}
+
+	name := pipelineName(pipeline, options)
+	if project.Name == name {
+		return true
+	}
+
+	separator := nameSeparator(options.Separator)
+	rest := strings.TrimPrefix(project.Name, name+separator)
+	if rest == project.Name {
+		return false
+	}
+
+	parts := strings.Count(rest, separator) + 1
+	switch options.Granularity {
+	case GranularityStage:
+		return parts == 1
+	case GranularityAction:
+		return parts == 2
+	}
+	return false
+}
+
+func buildName(separator string, names ...string) string {
+	return strings.Join(names, nameSeparator(separator))
+}
+
+func nameSeparator(separator string) string {
+	if separator == "" {
+		return DefaultSeparator
+	}
+	return separator
+}
+
+// pipelineName disambiguates pipelines with the same name in different regions and accounts
+func pipelineName(pipeline PipelineState, options ConvertOptions) string {
+	name := qualifyName(options.Separator, pipeline.Name, pipeline.Region, options.RegionNaming)
+	return qualifyName(options.Separator, name, pipeline.Account, options.AccountNaming)
+}
+
+func qualifyName(separator string, name string, qualifier string, placement NamePlacement) string {
+	if qualifier == "" {
+		return name
+	}
+
+	switch placement {
+	case NamePlacementPrefix:
+		return buildName(separator, qualifier, name)
+	case NamePlacementSuffix:
+		return buildName(separator, name, qualifier)
+	}
+	return name
+}
+
+func stageName(stage types.StageState) string {
+	if stage.StageName == nil {
+		return ""
+	}
+	return *stage.StageName
+}
+
+func actionName(action types.ActionState) string {
+	if action.ActionName == nil {
+		return ""
+	}
+	return *action.ActionName
+}
+
+// stageExecutionID is the ID of the pipeline execution that last ran the stage
+func stageExecutionID(stage types.StageState) string {
+	if stage.LatestExecution == nil || stage.LatestExecution.PipelineExecutionId == nil {
+		return ""
+	}
+	return *stage.LatestExecution.PipelineExecutionId
+}
+
+func buildWebURL(pipeline PipelineState) string {
+	return fmt.Sprintf("https://%s.console.aws.amazon.com/codesuite/codepipeline/pipelines/%s/view", pipeline.Region, pipeline.Name)
+}
+
+// stageLastBuildStatus reports the previous result of a stage while it is building
+func stageLastBuildStatus(pipeline PipelineState, stage types.StageState) LastBuildStatus {
+	if buildActivity(stage) == ActivityBuilding {
+		if status, ok := previousStageStatus(pipeline.History, stage); ok {
+			return status
+		}
+	}
+	return buildLastBuildStatus(stage)
+}
+
 func buildLastBuildStatus(stage types.StageState) LastBuildStatus {
 	if stage.LatestExecution == nil {
 		return LastBuildStatusUnknown
@@ -59,7 +374,7 @@ func buildLastBuildStatus(stage types.StageState) LastBuildStatus {
 		return LastBuildStatusSuccess
 	}
 
-	// assume Success as no easy way to work out previous state
+	// assume Success when there is no history to work out the previous state
 	return LastBuildStatusSuccess
 }
 
@@ -71,10 +386,78 @@ func buildActivity(stage types.StageState) Activity {
 	return ActivitySleeping
 }
 
+func buildLastBuildTime(created time.Time, stage types.StageState) string {
+	return getStageTime(created, stage).Format(time.RFC3339)
+}
+
+// getStageTime returns the most recent status change of any action in the stage,
+// falling back to the pipeline creation time when no action has run
 func getStageTime(created time.Time, stage types.StageState) time.Time {
-	if stage.ActionStates == nil || len(stage.ActionStates) == 0 ||
-		stage.ActionStates[0].LatestExecution == nil || stage.ActionStates[0].LatestExecution.LastStatusChange == nil {
+	var latest time.Time
+
+	for _, action := range stage.ActionStates {
+		if action.LatestExecution == nil || action.LatestExecution.LastStatusChange == nil {
+			continue
+		}
+		if action.LatestExecution.LastStatusChange.After(latest) {
+			latest = *action.LatestExecution.LastStatusChange
+		}
+	}
+
+	if latest.IsZero() {
 		return created
 	}
-	return *stage.ActionStates[0].LatestExecution.LastStatusChange
+	return latest
+}
+
+// actionLastBuildStatus reports the previous result of an action while it is building
+func actionLastBuildStatus(pipeline PipelineState, stage types.StageState, action types.ActionState) LastBuildStatus {
+	if buildActionActivity(action) == ActivityBuilding {
+		if status, ok := previousActionStatus(pipeline.History, stage, action); ok {
+			return status
+		}
+	}
+	return buildActionLastBuildStatus(action)
+}
+
+func buildActionLastBuildStatus(action types.ActionState) LastBuildStatus {
+	if action.LatestExecution == nil {
+		return LastBuildStatusUnknown
+	}
+
+	switch action.LatestExecution.Status {
+	case types.ActionExecutionStatusFailed:
+		return LastBuildStatusFailure
+	case types.ActionExecutionStatusSucceeded:
+		return LastBuildStatusSuccess
+	case types.ActionExecutionStatusAbandoned:
+		return LastBuildStatusUnknown
+	}
+
+	// assume Success when there is no history to work out the previous state
+	return LastBuildStatusSuccess
+}
+
+func buildActionActivity(action types.ActionState) Activity {
+	if action.LatestExecution != nil && action.LatestExecution.Status == types.ActionExecutionStatusInProgress {
+		return ActivityBuilding
+	}
+
+	return ActivitySleeping
+}
+
+func buildActionLastBuildTime(created time.Time, action types.ActionState) string {
+	if action.LatestExecution == nil || action.LatestExecution.LastStatusChange == nil {
+		return created.Format(time.RFC3339)
+	}
+	return action.LatestExecution.LastStatusChange.Format(time.RFC3339)
+}
+
+// buildActionWebURL links to the external execution, such as the CodeBuild log,
+// falling back to the pipeline overview when the action has not run
+func buildActionWebURL(pipeline PipelineState, action types.ActionState) string {
+	if action.LatestExecution != nil && action.LatestExecution.ExternalExecutionUrl != nil {
+		return *action.LatestExecution.ExternalExecutionUrl
+	}
+	return buildWebURL(pipeline)
 }
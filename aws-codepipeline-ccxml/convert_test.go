@@ -1,10 +1,11 @@
 package main
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
 )
 
 func createTime(rfc3339 string) time.Time {
@@ -17,44 +18,44 @@ func createTime(rfc3339 string) time.Time {
 
 func TestConvert(t *testing.T) {
 	stageNames := []string{"stage-1", "stage-2", "stage-3"}
-	latestExecutions := []codepipeline.StageExecution{
-		codepipeline.StageExecution{Status: codepipeline.StageExecutionStatusSucceeded},
-		codepipeline.StageExecution{Status: codepipeline.StageExecutionStatusFailed},
-		codepipeline.StageExecution{Status: codepipeline.StageExecutionStatusInProgress},
+	latestExecutions := []types.StageExecution{
+		types.StageExecution{Status: types.StageExecutionStatusSucceeded},
+		types.StageExecution{Status: types.StageExecutionStatusFailed},
+		types.StageExecution{Status: types.StageExecutionStatusInProgress},
 	}
 	latestExecutionTimes := []time.Time{createTime("2019-02-06T20:33:15Z"), createTime("2019-02-06T21:14:13Z"), createTime("2019-02-07T01:12:50Z")}
 
 	pipelineState1 := PipelineState{
 		Name: "test-pipeline",
-		StageStates: []codepipeline.StageState{
-			codepipeline.StageState{
+		StageStates: []types.StageState{
+			types.StageState{
 				StageName:       &stageNames[0],
 				LatestExecution: &latestExecutions[0],
-				ActionStates: []codepipeline.ActionState{
-					codepipeline.ActionState{
-						LatestExecution: &codepipeline.ActionExecution{
+				ActionStates: []types.ActionState{
+					types.ActionState{
+						LatestExecution: &types.ActionExecution{
 							LastStatusChange: &latestExecutionTimes[0],
 						},
 					},
 				},
 			},
-			codepipeline.StageState{
+			types.StageState{
 				StageName:       &stageNames[1],
 				LatestExecution: &latestExecutions[1],
-				ActionStates: []codepipeline.ActionState{
-					codepipeline.ActionState{
-						LatestExecution: &codepipeline.ActionExecution{
+				ActionStates: []types.ActionState{
+					types.ActionState{
+						LatestExecution: &types.ActionExecution{
 							LastStatusChange: &latestExecutionTimes[1],
 						},
 					},
 				},
 			},
-			codepipeline.StageState{
+			types.StageState{
 				StageName:       &stageNames[2],
 				LatestExecution: &latestExecutions[2],
-				ActionStates: []codepipeline.ActionState{
-					codepipeline.ActionState{
-						LatestExecution: &codepipeline.ActionExecution{
+				ActionStates: []types.ActionState{
+					types.ActionState{
+						LatestExecution: &types.ActionExecution{
 							LastStatusChange: &latestExecutionTimes[2],
 						},
 					},
@@ -65,7 +66,7 @@ func TestConvert(t *testing.T) {
 
 	pipelineStates := []PipelineState{pipelineState1}
 
-	projects := Convert(pipelineStates)
+	projects := Convert(pipelineStates, ConvertOptions{Granularity: GranularityStage, Separator: DefaultSeparator})
 
 	if len(projects) != len(pipelineState1.StageStates) {
 		t.Errorf(`Convert(%v) does not return %d projects`, pipelineState1, len(pipelineState1.StageStates))
@@ -95,51 +96,51 @@ func TestConvert(t *testing.T) {
 func TestBuildName(t *testing.T) {
 	stageName := "stage-1"
 	expectName := "test-pipeline :: stage-1"
-	actualName := buildName("test-pipeline", codepipeline.StageState{StageName: &stageName})
+	actualName := buildName(DefaultSeparator, "test-pipeline", stageName)
 	if actualName != expectName {
 		t.Errorf(`buildName(...) is %s not %s`, actualName, expectName)
 	}
 }
 
 func TestBuildLastBuildStatus(t *testing.T) {
-	inputs := []codepipeline.StageExecution{
-		codepipeline.StageExecution{Status: codepipeline.StageExecutionStatusInProgress},
-		codepipeline.StageExecution{Status: codepipeline.StageExecutionStatusFailed},
-		codepipeline.StageExecution{Status: codepipeline.StageExecutionStatusSucceeded},
+	inputs := []types.StageExecution{
+		types.StageExecution{Status: types.StageExecutionStatusInProgress},
+		types.StageExecution{Status: types.StageExecutionStatusFailed},
+		types.StageExecution{Status: types.StageExecutionStatusSucceeded},
 	}
 
 	expectedOutputs := []LastBuildStatus{LastBuildStatusSuccess, LastBuildStatusFailure, LastBuildStatusSuccess}
 
 	for index, input := range inputs {
-		actual := buildLastBuildStatus(codepipeline.StageState{LatestExecution: &input})
+		actual := buildLastBuildStatus(types.StageState{LatestExecution: &input})
 		if actual != expectedOutputs[index] {
 			t.Errorf(`buildLastBuildStatus("%s") is %s not %s`, input.Status, actual, expectedOutputs[index])
 		}
 	}
 
-	actual := buildLastBuildStatus(codepipeline.StageState{})
+	actual := buildLastBuildStatus(types.StageState{})
 	if actual != LastBuildStatusUnknown {
 		t.Errorf("buildLastBuildStatus(nil) is %s not %s", actual, LastBuildStatusUnknown)
 	}
 }
 
 func TestBuildActivity(t *testing.T) {
-	inputs := []codepipeline.StageExecution{
-		codepipeline.StageExecution{Status: codepipeline.StageExecutionStatusInProgress},
-		codepipeline.StageExecution{Status: codepipeline.StageExecutionStatusFailed},
-		codepipeline.StageExecution{Status: codepipeline.StageExecutionStatusSucceeded},
+	inputs := []types.StageExecution{
+		types.StageExecution{Status: types.StageExecutionStatusInProgress},
+		types.StageExecution{Status: types.StageExecutionStatusFailed},
+		types.StageExecution{Status: types.StageExecutionStatusSucceeded},
 	}
 
 	expectedOutputs := []Activity{ActivityBuilding, ActivitySleeping, ActivitySleeping}
 
 	for index, input := range inputs {
-		actual := buildActivity(codepipeline.StageState{LatestExecution: &input})
+		actual := buildActivity(types.StageState{LatestExecution: &input})
 		if actual != expectedOutputs[index] {
 			t.Errorf(`buildActivity("%s") is %s not %s`, input.Status, actual, expectedOutputs[index])
 		}
 	}
 
-	actual := buildActivity(codepipeline.StageState{})
+	actual := buildActivity(types.StageState{})
 	if actual != ActivitySleeping {
 		t.Errorf("buildActivity(nil) is %s not %s", actual, ActivitySleeping)
 	}
@@ -149,10 +150,10 @@ func TestBuildLastBuildTime(t *testing.T) {
 	created := "2019-02-01T12:00:00Z"
 	expected := "2019-02-06T20:33:15Z"
 	lastStatusChange := createTime(expected)
-	input := codepipeline.StageState{
-		ActionStates: []codepipeline.ActionState{
-			codepipeline.ActionState{
-				LatestExecution: &codepipeline.ActionExecution{
+	input := types.StageState{
+		ActionStates: []types.ActionState{
+			types.ActionState{
+				LatestExecution: &types.ActionExecution{
 					LastStatusChange: &lastStatusChange,
 				},
 			},
@@ -165,9 +166,9 @@ func TestBuildLastBuildTime(t *testing.T) {
 		t.Errorf(`buildLastBuildTime(%v) is %s not %s`, input, actual, expected)
 	}
 
-	input = codepipeline.StageState{
-		ActionStates: []codepipeline.ActionState{
-			codepipeline.ActionState{},
+	input = types.StageState{
+		ActionStates: []types.ActionState{
+			types.ActionState{},
 		},
 	}
 
@@ -176,3 +177,319 @@ func TestBuildLastBuildTime(t *testing.T) {
 		t.Errorf(`buildLastBuildTime(%v) is %s not %s`, input, actual, created)
 	}
 }
+
+func TestConvertPipeline(t *testing.T) {
+	stageNames := []string{"stage-1", "stage-2"}
+	latestExecutions := []types.StageExecution{
+		types.StageExecution{Status: types.StageExecutionStatusFailed},
+		types.StageExecution{Status: types.StageExecutionStatusInProgress},
+	}
+	latestExecutionTimes := []time.Time{createTime("2019-02-06T20:33:15Z"), createTime("2019-02-07T01:12:50Z")}
+
+	pipelineState := PipelineState{
+		Name:   "test-pipeline",
+		Region: "eu-west-1",
+		StageStates: []types.StageState{
+			types.StageState{
+				StageName:       &stageNames[0],
+				LatestExecution: &latestExecutions[0],
+				ActionStates: []types.ActionState{
+					types.ActionState{LatestExecution: &types.ActionExecution{LastStatusChange: &latestExecutionTimes[0]}},
+				},
+			},
+			types.StageState{
+				StageName:       &stageNames[1],
+				LatestExecution: &latestExecutions[1],
+				ActionStates: []types.ActionState{
+					types.ActionState{LatestExecution: &types.ActionExecution{LastStatusChange: &latestExecutionTimes[1]}},
+				},
+			},
+		},
+	}
+
+	projects := Convert([]PipelineState{pipelineState}, ConvertOptions{Granularity: GranularityPipeline})
+
+	if len(projects) != 1 {
+		t.Fatalf("Convert(%v) returns %d projects not 1", pipelineState, len(projects))
+	}
+
+	project := projects[0]
+	if project.Name != "test-pipeline" {
+		t.Errorf("Convert(%v) project name is %s not %s", pipelineState, project.Name, "test-pipeline")
+	}
+	if project.LastBuildStatus != LastBuildStatusFailure {
+		t.Errorf("Convert(%v) last build status is %s not %s", pipelineState, project.LastBuildStatus, LastBuildStatusFailure)
+	}
+	if project.Activity != ActivityBuilding {
+		t.Errorf("Convert(%v) activity is %s not %s", pipelineState, project.Activity, ActivityBuilding)
+	}
+	if project.LastBuildTime != "2019-02-07T01:12:50Z" {
+		t.Errorf("Convert(%v) last build time is %s not %s", pipelineState, project.LastBuildTime, "2019-02-07T01:12:50Z")
+	}
+	expectedURL := "https://eu-west-1.console.aws.amazon.com/codesuite/codepipeline/pipelines/test-pipeline/view"
+	if project.WebURL != expectedURL {
+		t.Errorf("Convert(%v) web URL is %s not %s", pipelineState, project.WebURL, expectedURL)
+	}
+}
+
+func TestBuildNameSeparator(t *testing.T) {
+	expectName := "test-pipeline/stage-1"
+	actualName := buildName("/", "test-pipeline", "stage-1")
+	if actualName != expectName {
+		t.Errorf(`buildName(...) is %s not %s`, actualName, expectName)
+	}
+}
+
+func TestConvertActions(t *testing.T) {
+	stageName := "build"
+	actionNames := []string{"compile", "test"}
+	logURL := "https://console.aws.amazon.com/codebuild/home#/builds/test/view"
+	lastStatusChange := createTime("2019-02-06T20:33:15Z")
+
+	pipelineState := PipelineState{
+		Name:    "test-pipeline",
+		Region:  "eu-west-1",
+		Created: createTime("2019-02-01T12:00:00Z"),
+		StageStates: []types.StageState{
+			types.StageState{
+				StageName: &stageName,
+				ActionStates: []types.ActionState{
+					types.ActionState{
+						ActionName: &actionNames[0],
+						LatestExecution: &types.ActionExecution{
+							Status:               types.ActionExecutionStatusFailed,
+							LastStatusChange:     &lastStatusChange,
+							ExternalExecutionUrl: &logURL,
+						},
+					},
+					types.ActionState{
+						ActionName: &actionNames[1],
+					},
+				},
+			},
+		},
+	}
+
+	projects := Convert([]PipelineState{pipelineState}, ConvertOptions{Granularity: GranularityAction})
+
+	if len(projects) != 2 {
+		t.Fatalf("Convert(%v) returns %d projects not 2", pipelineState, len(projects))
+	}
+
+	expectedNames := []string{"test-pipeline :: build :: compile", "test-pipeline :: build :: test"}
+	expectedLastBuildStatus := []LastBuildStatus{LastBuildStatusFailure, LastBuildStatusUnknown}
+	expectedExecutionTimes := []string{"2019-02-06T20:33:15Z", "2019-02-01T12:00:00Z"}
+	expectedURLs := []string{logURL, "https://eu-west-1.console.aws.amazon.com/codesuite/codepipeline/pipelines/test-pipeline/view"}
+
+	for index, project := range projects {
+		if project.Name != expectedNames[index] {
+			t.Errorf("Convert(%v) project name %d is %s not %s", pipelineState, index, project.Name, expectedNames[index])
+		}
+		if project.LastBuildStatus != expectedLastBuildStatus[index] {
+			t.Errorf("Convert(%v) last build status %d is %s not %s", pipelineState, index, project.LastBuildStatus, expectedLastBuildStatus[index])
+		}
+		if project.LastBuildTime != expectedExecutionTimes[index] {
+			t.Errorf("Convert(%v) last build time %d is %s not %s", pipelineState, index, project.LastBuildTime, expectedExecutionTimes[index])
+		}
+		if project.WebURL != expectedURLs[index] {
+			t.Errorf("Convert(%v) web URL %d is %s not %s", pipelineState, index, project.WebURL, expectedURLs[index])
+		}
+	}
+}
+
+func TestBuildActionLastBuildStatus(t *testing.T) {
+	inputs := []types.ActionExecution{
+		types.ActionExecution{Status: types.ActionExecutionStatusInProgress},
+		types.ActionExecution{Status: types.ActionExecutionStatusAbandoned},
+		types.ActionExecution{Status: types.ActionExecutionStatusFailed},
+		types.ActionExecution{Status: types.ActionExecutionStatusSucceeded},
+	}
+
+	expectedStatuses := []LastBuildStatus{LastBuildStatusSuccess, LastBuildStatusUnknown, LastBuildStatusFailure, LastBuildStatusSuccess}
+	expectedActivities := []Activity{ActivityBuilding, ActivitySleeping, ActivitySleeping, ActivitySleeping}
+
+	for index, input := range inputs {
+		action := types.ActionState{LatestExecution: &input}
+		if actual := buildActionLastBuildStatus(action); actual != expectedStatuses[index] {
+			t.Errorf(`buildActionLastBuildStatus("%s") is %s not %s`, input.Status, actual, expectedStatuses[index])
+		}
+		if actual := buildActionActivity(action); actual != expectedActivities[index] {
+			t.Errorf(`buildActionActivity("%s") is %s not %s`, input.Status, actual, expectedActivities[index])
+		}
+	}
+}
+
+func TestConvertDisabledTransition(t *testing.T) {
+	stageNames := []string{"build", "production"}
+	reason := "change freeze"
+	user := "arn:aws:iam::123456789012:user/ops"
+	succeeded := types.StageExecution{Status: types.StageExecutionStatusSucceeded}
+
+	pipelineState := PipelineState{
+		Name: "test-pipeline",
+		StageStates: []types.StageState{
+			types.StageState{
+				StageName:       &stageNames[0],
+				LatestExecution: &succeeded,
+			},
+			types.StageState{
+				StageName:       &stageNames[1],
+				LatestExecution: &succeeded,
+				InboundTransitionState: &types.TransitionState{
+					Enabled:        false,
+					DisabledReason: &reason,
+					LastChangedBy:  &user,
+				},
+			},
+		},
+	}
+
+	expectedMessage := "Transition to production disabled by arn:aws:iam::123456789012:user/ops: change freeze"
+
+	projects := Convert([]PipelineState{pipelineState}, ConvertOptions{Granularity: GranularityStage, DisabledTransitions: TransitionTreatmentUnknown})
+	if projects[0].LastBuildStatus != LastBuildStatusSuccess || len(projects[0].Messages) != 0 {
+		t.Errorf("Convert(%v) stage behind an enabled transition is %s with %d messages", pipelineState, projects[0].LastBuildStatus, len(projects[0].Messages))
+	}
+	if projects[1].LastBuildStatus != LastBuildStatusUnknown {
+		t.Errorf("Convert(%v) stage behind a disabled transition is %s not %s", pipelineState, projects[1].LastBuildStatus, LastBuildStatusUnknown)
+	}
+	if len(projects[1].Messages) != 1 || projects[1].Messages[0].Text != expectedMessage {
+		t.Errorf("Convert(%v) stage behind a disabled transition has messages %v not %s", pipelineState, projects[1].Messages, expectedMessage)
+	}
+
+	projects = Convert([]PipelineState{pipelineState}, ConvertOptions{Granularity: GranularityPipeline, DisabledTransitions: TransitionTreatmentUnknown})
+	if projects[0].LastBuildStatus != LastBuildStatusUnknown || len(projects[0].Messages) != 1 {
+		t.Errorf("Convert(%v) pipeline with a disabled transition is %s with %d messages", pipelineState, projects[0].LastBuildStatus, len(projects[0].Messages))
+	}
+
+	projects = Convert([]PipelineState{pipelineState}, ConvertOptions{Granularity: GranularityStage, DisabledTransitions: TransitionTreatmentIgnore})
+	if projects[1].LastBuildStatus != LastBuildStatusSuccess || len(projects[1].Messages) != 0 {
+		t.Errorf("Convert(%v) ignored disabled transition is %s with %d messages", pipelineState, projects[1].LastBuildStatus, len(projects[1].Messages))
+	}
+}
+
+func TestPipelineNameRegionNaming(t *testing.T) {
+	pipelineState := PipelineState{Name: "test-pipeline", Region: "eu-west-1"}
+
+	namings := []NamePlacement{NamePlacementNone, NamePlacementPrefix, NamePlacementSuffix}
+	expectedNames := []string{"test-pipeline", "eu-west-1 :: test-pipeline", "test-pipeline :: eu-west-1"}
+
+	for index, naming := range namings {
+		actual := pipelineName(pipelineState, ConvertOptions{RegionNaming: naming})
+		if actual != expectedNames[index] {
+			t.Errorf("pipelineName(%s) is %s not %s", naming, actual, expectedNames[index])
+		}
+	}
+}
+
+func TestPipelineNameAccountNaming(t *testing.T) {
+	pipelineState := PipelineState{Name: "test-pipeline", Region: "eu-west-1", Account: "production"}
+
+	actual := pipelineName(pipelineState, ConvertOptions{RegionNaming: NamePlacementSuffix, AccountNaming: NamePlacementPrefix})
+	expected := "production :: test-pipeline :: eu-west-1"
+	if actual != expected {
+		t.Errorf("pipelineName(...) is %s not %s", actual, expected)
+	}
+}
+
+func TestConvertPipelineDetail(t *testing.T) {
+	stageNames := []string{"build", "deploy"}
+	executionIDs := []string{"old-execution", "new-execution"}
+	changes := []time.Time{createTime("2019-02-06T20:33:15Z"), createTime("2019-02-06T21:14:13Z")}
+
+	pipelineState := PipelineState{
+		Name:    "test-pipeline",
+		Region:  "eu-west-1",
+		Account: "123456789012",
+		Tags:    map[string]string{"team": "checkout"},
+		StageStates: []types.StageState{
+			types.StageState{
+				StageName:       &stageNames[0],
+				LatestExecution: &types.StageExecution{Status: types.StageExecutionStatusSucceeded, PipelineExecutionId: &executionIDs[0]},
+				ActionStates: []types.ActionState{
+					types.ActionState{LatestExecution: &types.ActionExecution{LastStatusChange: &changes[0]}},
+				},
+			},
+			types.StageState{
+				StageName:       &stageNames[1],
+				LatestExecution: &types.StageExecution{Status: types.StageExecutionStatusFailed, PipelineExecutionId: &executionIDs[1]},
+				ActionStates: []types.ActionState{
+					types.ActionState{LatestExecution: &types.ActionExecution{LastStatusChange: &changes[1]}},
+				},
+			},
+		},
+	}
+
+	projects := Convert([]PipelineState{pipelineState}, ConvertOptions{Granularity: GranularityPipeline})
+	if len(projects) != 1 {
+		t.Fatalf("Convert(...) returned %d projects not 1", len(projects))
+	}
+
+	project := projects[0]
+	if project.Pipeline != "test-pipeline" || project.Region != "eu-west-1" || project.Account != "123456789012" {
+		t.Errorf("Convert(...) pipeline is %s in %s of %s", project.Pipeline, project.Region, project.Account)
+	}
+	if project.Tags["team"] != "checkout" {
+		t.Errorf("Convert(...) tags are %v", project.Tags)
+	}
+	if project.ExecutionID != "new-execution" {
+		t.Errorf("Convert(...) execution ID is %s not new-execution", project.ExecutionID)
+	}
+
+	expected := []Stage{
+		Stage{Name: "build", Activity: ActivitySleeping, LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-02-06T20:33:15Z", ExecutionID: "old-execution"},
+		Stage{Name: "deploy", Activity: ActivitySleeping, LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-02-06T21:14:13Z", ExecutionID: "new-execution"},
+	}
+	if len(project.Stages) != len(expected) {
+		t.Fatalf("Convert(...) has %d stages not %d", len(project.Stages), len(expected))
+	}
+	for i, stage := range project.Stages {
+		if stage != expected[i] {
+			t.Errorf("Convert(...) stage %d is %+v not %+v", i, stage, expected[i])
+		}
+	}
+}
+
+func TestReplacePipelineProjects(t *testing.T) {
+	options := ConvertOptions{Granularity: GranularityStage, Separator: "-"}
+	pipeline := PipelineState{Name: "app", Region: "eu-west-1"}
+	replacement := []Project{Project{Name: "app-Deploy"}}
+
+	// projects read back from an XML feed are matched by name, which the separator also appears in
+	existing := []Project{Project{Name: "app-Build"}, Project{Name: "app-web-Build"}, Project{Name: "other-Build"}}
+	expected := []string{"app-Deploy", "app-web-Build", "other-Build"}
+
+	names := make([]string, 0)
+	for _, project := range ReplacePipelineProjects(existing, pipeline, replacement, options) {
+		names = append(names, project.Name)
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("ReplacePipelineProjects(...) is %v not %v", names, expected)
+	}
+
+	// projects that record their pipeline are matched by it
+	existing = []Project{
+		Project{Name: "app-Build", Pipeline: "app", Region: "eu-west-1"},
+		Project{Name: "app-Build", Pipeline: "app", Region: "us-east-1"},
+		Project{Name: "app-web-Build", Pipeline: "app-web", Region: "eu-west-1"},
+	}
+	expected = []string{"app-Deploy", "app-Build", "app-web-Build"}
+
+	names = make([]string, 0)
+	for _, project := range ReplacePipelineProjects(existing, pipeline, replacement, options) {
+		names = append(names, project.Name)
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("ReplacePipelineProjects(...) is %v not %v", names, expected)
+	}
+
+	// a pipeline that is no longer reported on is removed, and a new one appended
+	projects := ReplacePipelineProjects([]Project{Project{Name: "app-Build"}}, pipeline, nil, options)
+	if len(projects) != 0 {
+		t.Errorf("ReplacePipelineProjects(...) without a replacement is %v", projects)
+	}
+	projects = ReplacePipelineProjects([]Project{Project{Name: "other-Build"}}, pipeline, replacement, options)
+	if len(projects) != 2 || projects[1].Name != "app-Deploy" {
+		t.Errorf("ReplacePipelineProjects(...) of a new pipeline is %v", projects)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// DashboardContentType is the Content-Type of the dashboard
+const DashboardContentType = "text/html; charset=utf-8"
+
+// DefaultDashboardRefresh is how often the dashboard reloads itself
+const DefaultDashboardRefresh = time.Minute
+
+// DashboardPersistenceProvider persists an HTML dashboard of the projects, for those without a CCTray client
+type DashboardPersistenceProvider struct {
+	writer  ObjectWriter
+	name    string
+	refresh time.Duration
+	// options name the projects, so that those that do not record their pipeline can still be grouped
+	options ConvertOptions
+}
+
+// PersistProjects as a dashboard
+func (p *DashboardPersistenceProvider) PersistProjects(projects []Project) (PersistStatus, error) {
+	var b bytes.Buffer
+	err := RenderDashboard(projects, p.refresh, p.options, &b)
+	if err != nil {
+		return "", fmt.Errorf("unable to render dashboard: %v", err)
+	}
+
+	return p.writer.WriteObject(p.name, b.Bytes(), DashboardContentType, "")
+}
+
+type dashboard struct {
+	Refresh int
+	Groups  []dashboardGroup
+}
+
+// dashboardGroup holds the projects of a single pipeline
+type dashboardGroup struct {
+	Title  string
+	Detail string
+	Tiles  []dashboardTile
+}
+
+type dashboardTile struct {
+	Label    string
+	Status   string
+	Building bool
+	Time     string
+	WebURL   string
+	Messages Messages
+}
+
+// RenderDashboard renders a self-contained HTML page showing the projects grouped by pipeline. The
+// page holds nothing that changes unless the projects do, so it is only rewritten when they change
+func RenderDashboard(projects []Project, refresh time.Duration, options ConvertOptions, w io.Writer) error {
+	if refresh <= 0 {
+		refresh = DefaultDashboardRefresh
+	}
+
+	return dashboardTemplate.Execute(w, dashboard{
+		Refresh: int(refresh.Seconds()),
+		Groups:  groupProjects(projects, options),
+	})
+}
+
+// groupProjects groups the projects by pipeline in the order they are first reported
+func groupProjects(projects []Project, options ConvertOptions) []dashboardGroup {
+	groups := make([]dashboardGroup, 0)
+	indexes := make(map[string]int)
+
+	for _, project := range projects {
+		title, label := splitPipelineName(project, options)
+		key := strings.Join([]string{title, project.Account, project.Region}, "/")
+
+		i, ok := indexes[key]
+		if !ok {
+			i = len(groups)
+			indexes[key] = i
+			groups = append(groups, dashboardGroup{
+				Title:  title,
+				Detail: strings.TrimSpace(project.Account + " " + project.Region),
+			})
+		}
+
+		groups[i].Tiles = append(groups[i].Tiles, dashboardTile{
+			Label:    label,
+			Status:   strings.ToLower(string(project.LastBuildStatus)),
+			Building: project.Activity == ActivityBuilding,
+			Time:     project.LastBuildTime,
+			WebURL:   project.WebURL,
+			Messages: project.Messages,
+		})
+	}
+
+	return groups
+}
+
+// splitPipelineName splits the name of a project into the qualified name of its pipeline and the
+// stage and action it reports on, if any. Projects that do not record their pipeline, such as those
+// read back from an XML feed, are split by the number of names the granularity adds to the pipeline's
+func splitPipelineName(project Project, options ConvertOptions) (string, string) {
+	separator := nameSeparator(options.Separator)
+	names := strings.Split(project.Name, separator)
+
+	if project.Pipeline == "" {
+		labels := 0
+		switch options.Granularity {
+		case GranularityStage:
+			labels = 1
+		case GranularityAction:
+			labels = 2
+		}
+		if len(names) <= labels {
+			return project.Name, ""
+		}
+		return strings.Join(names[:len(names)-labels], separator), strings.Join(names[len(names)-labels:], separator)
+	}
+
+	for i, name := range names {
+		if name == project.Pipeline {
+			return strings.Join(names[:i+1], separator), strings.Join(names[i+1:], separator)
+		}
+	}
+	return project.Name, ""
+}
+
+// formatDashboardTime shows the last build time until the script replaces it with a relative time
+func formatDashboardTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.UTC().Format("2 Jan 2006 15:04 MST")
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"formatTime": formatDashboardTime,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Pipelines</title>
+<style>
+body { margin: 0; padding: 1rem; background: #1e1e1e; color: #fff; font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; }
+section { margin-bottom: 1.5rem; }
+h2 { margin: 0 0 0.5rem; font-size: 1.2rem; font-weight: normal; }
+h2 small { color: #aaa; font-size: 0.8rem; margin-left: 0.5rem; }
+.tiles { display: grid; grid-template-columns: repeat(auto-fill, minmax(14rem, 1fr)); gap: 0.5rem; }
+.tile { display: block; padding: 0.75rem; border-radius: 4px; color: #fff; text-decoration: none; }
+.tile strong { display: block; font-size: 1.1rem; }
+.tile span { display: block; font-size: 0.85rem; opacity: 0.85; }
+.success { background: #2e7d32; }
+.failure, .exception { background: #c62828; }
+.unknown { background: #616161; }
+.building { animation: building 1.5s ease-in-out infinite alternate; }
+@keyframes building { from { opacity: 1; } to { opacity: 0.55; } }
+</style>
+</head>
+<body>
+{{- range .Groups}}
+<section>
+<h2>{{.Title}}{{if .Detail}}<small>{{.Detail}}</small>{{end}}</h2>
+<div class="tiles">
+{{- range .Tiles}}
+<a class="tile {{.Status}}{{if .Building}} building{{end}}" href="{{.WebURL}}">
+<strong>{{if .Label}}{{.Label}}{{else}}{{.Status}}{{end}}</strong>
+<span>{{.Status}}{{if .Building}}, building{{end}}</span>
+<span><time datetime="{{.Time}}">{{formatTime .Time}}</time></span>
+{{- range .Messages}}
+<span>{{.Text}}</span>
+{{- end}}
+</a>
+{{- end}}
+</div>
+</section>
+{{- end}}
+<script>
+(function () {
+  var units = [["year", 31536000], ["month", 2592000], ["day", 86400], ["hour", 3600], ["minute", 60]];
+  var format = new Intl.RelativeTimeFormat("en", { numeric: "auto" });
+  document.querySelectorAll("time").forEach(function (element) {
+    var seconds = (Date.parse(element.getAttribute("datetime")) - Date.now()) / 1000;
+    if (isNaN(seconds)) {
+      return;
+    }
+    for (var i = 0; i < units.length; i++) {
+      if (Math.abs(seconds) >= units[i][1]) {
+        element.textContent = format.format(Math.round(seconds / units[i][1]), units[i][0]);
+        return;
+      }
+    }
+    element.textContent = "just now";
+  });
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupProjects(t *testing.T) {
+	projects := []Project{
+		Project{Name: "prod :: service :: build", Pipeline: "service", Account: "prod", LastBuildStatus: LastBuildStatusSuccess},
+		Project{Name: "prod :: service :: deploy", Pipeline: "service", Account: "prod", LastBuildStatus: LastBuildStatusFailure, Activity: ActivityBuilding},
+		Project{Name: "legacy", LastBuildStatus: LastBuildStatusUnknown},
+	}
+
+	groups := groupProjects(projects, ConvertOptions{Granularity: GranularityStage, Separator: DefaultSeparator})
+	if len(groups) != 2 {
+		t.Fatalf("groupProjects(...) returned %d groups not 2", len(groups))
+	}
+
+	if groups[0].Title != "prod :: service" || groups[0].Detail != "prod" {
+		t.Errorf("groupProjects(...) first group is %s (%s)", groups[0].Title, groups[0].Detail)
+	}
+	labels := []string{groups[0].Tiles[0].Label, groups[0].Tiles[1].Label}
+	if !reflect.DeepEqual(labels, []string{"build", "deploy"}) {
+		t.Errorf("groupProjects(...) tiles are %v not [build deploy]", labels)
+	}
+	if groups[0].Tiles[1].Status != "failure" || !groups[0].Tiles[1].Building {
+		t.Errorf("groupProjects(...) deploy tile is %+v", groups[0].Tiles[1])
+	}
+
+	if groups[1].Title != "legacy" || groups[1].Tiles[0].Label != "" {
+		t.Errorf("groupProjects(...) second group is %+v", groups[1])
+	}
+}
+
+func TestGroupProjectsWithoutPipeline(t *testing.T) {
+	// projects read back from an XML feed only have their names
+	projects := []Project{
+		Project{Name: "my-service-Source-GitHub"},
+		Project{Name: "my-service-Build-CodeBuild"},
+		Project{Name: "other"},
+	}
+
+	groups := groupProjects(projects, ConvertOptions{Granularity: GranularityAction, Separator: "-"})
+	if len(groups) != 2 {
+		t.Fatalf("groupProjects(...) returned %d groups not 2", len(groups))
+	}
+	if groups[0].Title != "my-service" || len(groups[0].Tiles) != 2 || groups[0].Tiles[1].Label != "Build-CodeBuild" {
+		t.Errorf("groupProjects(...) first group is %+v", groups[0])
+	}
+	if groups[1].Title != "other" || groups[1].Tiles[0].Label != "" {
+		t.Errorf("groupProjects(...) second group is %+v", groups[1])
+	}
+
+	groups = groupProjects(projects[:1], ConvertOptions{Separator: "-"})
+	if groups[0].Title != "my-service-Source-GitHub" {
+		t.Errorf("groupProjects(...) split a pipeline project into %s", groups[0].Title)
+	}
+}
+
+func TestRenderDashboard(t *testing.T) {
+	projects := []Project{
+		Project{
+			Name:            "<service>",
+			LastBuildStatus: LastBuildStatusSuccess,
+			LastBuildTime:   "2019-01-01T00:00:00Z",
+			WebURL:          "javascript:alert(1)",
+		},
+	}
+
+	var b bytes.Buffer
+	err := RenderDashboard(projects, 30*time.Second, ConvertOptions{}, &b)
+	if err != nil {
+		t.Fatalf("RenderDashboard(...) returned %v", err)
+	}
+
+	html := b.String()
+	for _, expected := range []string{
+		`<meta http-equiv="refresh" content="30">`,
+		`&lt;service&gt;`,
+		`<time datetime="2019-01-01T00:00:00Z">1 Jan 2019 00:00 UTC</time>`,
+		`class="tile success"`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("RenderDashboard(...) does not contain %s", expected)
+		}
+	}
+	if strings.Contains(html, "javascript:alert") {
+		t.Errorf("RenderDashboard(...) links to an unsafe URL")
+	}
+}
+
+func TestDashboardPersistenceProvider(t *testing.T) {
+	writer := &recordingObjectWriter{objects: map[string][]byte{}}
+	provider := DashboardPersistenceProvider{writer, "index.html", 0, ConvertOptions{}}
+
+	_, err := provider.PersistProjects([]Project{Project{Name: "service"}})
+	if err != nil {
+		t.Fatalf("PersistProjects(...) returned %v", err)
+	}
+	if _, ok := writer.objects["index.html"]; !ok || writer.contentType != DashboardContentType {
+		t.Errorf("PersistProjects(...) did not write index.html as %s", DashboardContentType)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// scheduledEventSource and scheduledEventDetailType identify events raised by an EventBridge schedule
+const (
+	scheduledEventSource     = "aws.events"
+	scheduledEventDetailType = "Scheduled Event"
+)
+
+// IsScheduledEvent is true for events raised by an EventBridge schedule rather than by CodePipeline
+func IsScheduledEvent(event events.EventBridgeEvent) bool {
+	return event.Source == scheduledEventSource && event.DetailType == scheduledEventDetailType
+}
+
+// RouteEvent works out which pipeline an EventBridge event refers to. Events that do not require
+// the feed to be updated are ignored, with the reason returned as an error
+func RouteEvent(event events.EventBridgeEvent, options ConvertOptions) (PipelineRef, error) {
+	if event.Source != events.CodePipelineEventSource {
+		return PipelineRef{}, fmt.Errorf("ignoring event from unrelated source %q", event.Source)
+	}
+
+	switch event.DetailType {
+	case events.CodePipelineExecutionEventDetailType, events.CodePipelineStageEventDetailType:
+	case events.CodePipelineActionEventDetailType:
+		// stage events already cover changes in the status of actions unless actions are reported
+		if options.Granularity != GranularityAction {
+			return PipelineRef{}, fmt.Errorf("ignoring %q as actions are not reported", event.DetailType)
+		}
+	default:
+		return PipelineRef{}, fmt.Errorf("ignoring unrelated event %q", event.DetailType)
+	}
+
+	var detail events.CodePipelineEventDetail
+	err := json.Unmarshal(event.Detail, &detail)
+	if err != nil {
+		return PipelineRef{}, fmt.Errorf("ignoring %q with invalid detail: %v", event.DetailType, err)
+	}
+
+	return PipelineRef{Name: detail.Pipeline, Region: event.Region, AccountID: event.AccountID}, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestRouteEvent(t *testing.T) {
+	detail := json.RawMessage(`{"pipeline": "test-pipeline", "stage": "build", "state": "STARTED"}`)
+
+	for _, detailType := range []string{events.CodePipelineExecutionEventDetailType, events.CodePipelineStageEventDetailType} {
+		event := events.EventBridgeEvent{
+			Source:     events.CodePipelineEventSource,
+			DetailType: detailType,
+			AccountID:  "123456789012",
+			Region:     "eu-west-1",
+			Detail:     detail,
+		}
+
+		ref, err := RouteEvent(event, ConvertOptions{Granularity: GranularityStage})
+		if err != nil {
+			t.Fatalf("RouteEvent(%s) returned %v", detailType, err)
+		}
+
+		expected := PipelineRef{Name: "test-pipeline", Region: "eu-west-1", AccountID: "123456789012"}
+		if ref != expected {
+			t.Errorf("RouteEvent(%s) is %v not %v", detailType, ref, expected)
+		}
+	}
+}
+
+func TestRouteEventActions(t *testing.T) {
+	event := events.EventBridgeEvent{
+		Source:     events.CodePipelineEventSource,
+		DetailType: events.CodePipelineActionEventDetailType,
+		Detail:     json.RawMessage(`{"pipeline": "test-pipeline", "stage": "build", "action": "compile"}`),
+	}
+
+	_, err := RouteEvent(event, ConvertOptions{Granularity: GranularityStage})
+	if err == nil {
+		t.Errorf("RouteEvent(...) did not ignore an action event when reporting stages")
+	}
+
+	ref, err := RouteEvent(event, ConvertOptions{Granularity: GranularityAction})
+	if err != nil || ref.Name != "test-pipeline" {
+		t.Errorf("RouteEvent(...) is %v, %v when reporting actions", ref, err)
+	}
+}
+
+func TestRouteEventIgnored(t *testing.T) {
+	inputs := []events.EventBridgeEvent{
+		events.EventBridgeEvent{Source: "aws.events", DetailType: "Scheduled Event", Detail: json.RawMessage(`{}`)},
+		events.EventBridgeEvent{Source: events.CodePipelineEventSource, DetailType: "CodePipeline Unknown Change", Detail: json.RawMessage(`{}`)},
+		events.EventBridgeEvent{Source: events.CodePipelineEventSource, DetailType: events.CodePipelineStageEventDetailType, Detail: json.RawMessage(`[]`)},
+	}
+
+	for _, input := range inputs {
+		_, err := RouteEvent(input, ConvertOptions{})
+		if err == nil {
+			t.Errorf("RouteEvent(%s, %s) was not ignored", input.Source, input.DetailType)
+		}
+	}
+}
+
+func TestIsScheduledEvent(t *testing.T) {
+	scheduled := events.EventBridgeEvent{Source: "aws.events", DetailType: "Scheduled Event"}
+	if !IsScheduledEvent(scheduled) {
+		t.Errorf("IsScheduledEvent(...) is false for a scheduled event")
+	}
+
+	stage := events.EventBridgeEvent{Source: events.CodePipelineEventSource, DetailType: events.CodePipelineStageEventDetailType}
+	if IsScheduledEvent(stage) {
+		t.Errorf("IsScheduledEvent(...) is true for a stage event")
+	}
+}
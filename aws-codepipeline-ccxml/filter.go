@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ProjectFilter selects the projects a team wall is interested in. A project is selected when it
+// matches any one of the values given for each parameter, and every parameter given
+type ProjectFilter struct {
+	// Pipelines are patterns, such as payments-*, matched against the name of the pipeline
+	Pipelines []string
+	Statuses  []LastBuildStatus
+	Regions   []string
+	// Tags are pipeline tags written as key:value, or as key to select pipelines with the tag whatever its value
+	Tags []string
+}
+
+// ParseProjectFilter parses the pipeline, status, region and tag query parameters of a request, each of
+// which may be repeated or hold a comma separated list. Other parameters are ignored
+func ParseProjectFilter(query url.Values) (ProjectFilter, error) {
+	filter := ProjectFilter{
+		Pipelines: queryValues(query, "pipeline"),
+		Regions:   queryValues(query, "region"),
+		Tags:      queryValues(query, "tag"),
+	}
+
+	for _, pattern := range filter.Pipelines {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return ProjectFilter{}, fmt.Errorf("invalid pipeline pattern %s: %v", pattern, err)
+		}
+	}
+
+	// statuses are written in any case, so are only sorted and deduplicated once they are parsed
+	seen := make(map[LastBuildStatus]bool)
+	for _, value := range queryValues(query, "status") {
+		status, ok := parseLastBuildStatus(value)
+		if !ok {
+			return ProjectFilter{}, fmt.Errorf("invalid status %s", value)
+		}
+		if !seen[status] {
+			seen[status] = true
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	sort.Slice(filter.Statuses, func(i, j int) bool {
+		return filter.Statuses[i] < filter.Statuses[j]
+	})
+
+	return filter, nil
+}
+
+// queryValues are the values of a query parameter, split on commas, sorted and without duplicates
+func queryValues(query url.Values, name string) []string {
+	seen := make(map[string]bool)
+	values := make([]string, 0)
+	for _, value := range query[name] {
+		for _, v := range splitList(value) {
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// parseLastBuildStatus parses a status whatever its case, such as failure for Failure
+func parseLastBuildStatus(value string) (LastBuildStatus, bool) {
+	for _, status := range []LastBuildStatus{LastBuildStatusSuccess, LastBuildStatusFailure, LastBuildStatusException, LastBuildStatusUnknown} {
+		if strings.EqualFold(value, string(status)) {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// Empty is true when the filter selects every project
+func (f ProjectFilter) Empty() bool {
+	return len(f.Pipelines) == 0 && len(f.Statuses) == 0 && len(f.Regions) == 0 && len(f.Tags) == 0
+}
+
+// Key normalizes the filter, so that queries selecting the same projects share a key
+func (f ProjectFilter) Key() string {
+	query := url.Values{}
+	for _, pattern := range f.Pipelines {
+		query.Add("pipeline", pattern)
+	}
+	for _, status := range f.Statuses {
+		query.Add("status", string(status))
+	}
+	for _, region := range f.Regions {
+		query.Add("region", region)
+	}
+	for _, tag := range f.Tags {
+		query.Add("tag", tag)
+	}
+	return query.Encode()
+}
+
+// Apply the filter, returning the selected projects in the order they are given
+func (f ProjectFilter) Apply(projects []Project) []Project {
+	if f.Empty() {
+		return projects
+	}
+
+	selected := make([]Project, 0)
+	for _, project := range projects {
+		if f.matches(project) {
+			selected = append(selected, project)
+		}
+	}
+	return selected
+}
+
+func (f ProjectFilter) matches(project Project) bool {
+	return f.matchesPipeline(project) && f.matchesStatus(project) && f.matchesRegion(project) && f.matchesTag(project)
+}
+
+func (f ProjectFilter) matchesPipeline(project Project) bool {
+	if len(f.Pipelines) == 0 {
+		return true
+	}
+
+	// projects read back from an XML feed do not record their pipeline
+	name := project.Pipeline
+	if name == "" {
+		name = project.Name
+	}
+	for _, pattern := range f.Pipelines {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (f ProjectFilter) matchesStatus(project Project) bool {
+	if len(f.Statuses) == 0 {
+		return true
+	}
+
+	for _, status := range f.Statuses {
+		if project.LastBuildStatus == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (f ProjectFilter) matchesRegion(project Project) bool {
+	if len(f.Regions) == 0 {
+		return true
+	}
+
+	for _, region := range f.Regions {
+		if project.Region == region {
+			return true
+		}
+	}
+	return false
+}
+
+func (f ProjectFilter) matchesTag(project Project) bool {
+	if len(f.Tags) == 0 {
+		return true
+	}
+
+	for _, tag := range f.Tags {
+		key, value, hasValue := strings.Cut(tag, ":")
+		v, ok := project.Tags[key]
+		if ok && (!hasValue || v == value) {
+			return true
+		}
+	}
+	return false
+}
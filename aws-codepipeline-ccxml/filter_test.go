@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseProjectFilter(t *testing.T) {
+	query, _ := url.ParseQuery("status=failure&status=Exception,Failure&pipeline=payments-*&region=eu-west-1&tag=team:checkout&refresh=1")
+	filter, err := ParseProjectFilter(query)
+	if err != nil {
+		t.Fatalf("ParseProjectFilter(...) returned %v", err)
+	}
+
+	expected := ProjectFilter{
+		Pipelines: []string{"payments-*"},
+		Statuses:  []LastBuildStatus{LastBuildStatusException, LastBuildStatusFailure},
+		Regions:   []string{"eu-west-1"},
+		Tags:      []string{"team:checkout"},
+	}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("ParseProjectFilter(...) is %+v not %+v", filter, expected)
+	}
+
+	for _, invalid := range []string{"status=broken", "pipeline=payments-["} {
+		query, _ := url.ParseQuery(invalid)
+		if _, err := ParseProjectFilter(query); err == nil {
+			t.Errorf("ParseProjectFilter(%s) did not return an error", invalid)
+		}
+	}
+}
+
+func TestProjectFilterKey(t *testing.T) {
+	a, _ := ParseProjectFilter(url.Values{"status": {"failure"}, "region": {"eu-west-1,us-east-1"}})
+	b, _ := ParseProjectFilter(url.Values{"region": {"us-east-1", "eu-west-1"}, "status": {"Failure"}, "other": {"1"}})
+	if a.Key() != b.Key() {
+		t.Errorf("ProjectFilter.Key() is %s and %s for the same projects", a.Key(), b.Key())
+	}
+
+	if (ProjectFilter{}).Key() != "" {
+		t.Errorf("ProjectFilter{}.Key() is %s", (ProjectFilter{}).Key())
+	}
+}
+
+func TestProjectFilterApply(t *testing.T) {
+	projects := []Project{
+		Project{Name: "payments-api", Pipeline: "payments-api", Region: "eu-west-1", LastBuildStatus: LastBuildStatusFailure, Tags: map[string]string{"team": "checkout"}},
+		Project{Name: "payments-web", Pipeline: "payments-web", Region: "us-east-1", LastBuildStatus: LastBuildStatusSuccess, Tags: map[string]string{"team": "checkout"}},
+		Project{Name: "search", Pipeline: "search", Region: "eu-west-1", LastBuildStatus: LastBuildStatusFailure, Tags: map[string]string{"team": "discovery"}},
+		Project{Name: "legacy", Region: "eu-west-1", LastBuildStatus: LastBuildStatusUnknown},
+	}
+
+	for _, test := range []struct {
+		filter   ProjectFilter
+		expected []string
+	}{
+		{ProjectFilter{}, []string{"payments-api", "payments-web", "search", "legacy"}},
+		{ProjectFilter{Pipelines: []string{"payments-*"}}, []string{"payments-api", "payments-web"}},
+		{ProjectFilter{Pipelines: []string{"leg*"}}, []string{"legacy"}},
+		{ProjectFilter{Statuses: []LastBuildStatus{LastBuildStatusFailure}}, []string{"payments-api", "search"}},
+		{ProjectFilter{Regions: []string{"us-east-1"}}, []string{"payments-web"}},
+		{ProjectFilter{Tags: []string{"team:checkout"}}, []string{"payments-api", "payments-web"}},
+		{ProjectFilter{Tags: []string{"team"}}, []string{"payments-api", "payments-web", "search"}},
+		{ProjectFilter{Tags: []string{"team:checkout", "team:discovery"}}, []string{"payments-api", "payments-web", "search"}},
+		{ProjectFilter{Pipelines: []string{"payments-*"}, Statuses: []LastBuildStatus{LastBuildStatusFailure}}, []string{"payments-api"}},
+		{ProjectFilter{Regions: []string{"ap-southeast-2"}}, []string{}},
+	} {
+		names := make([]string, 0)
+		for _, project := range test.filter.Apply(projects) {
+			names = append(names, project.Name)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%+v.Apply(...) is %v not %v", test.filter, names, test.expected)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+)
+
+// CodePipeline only reports the status of the latest execution of a stage, so while a stage
+// is running the result of its previous execution has to be recovered from the action
+// execution history. This keeps a broken pipeline red while it rebuilds, as CCTray expects.
+
+func isFinished(execution types.ActionExecutionDetail) bool {
+	return execution.Status == types.ActionExecutionStatusSucceeded || execution.Status == types.ActionExecutionStatusFailed
+}
+
+func hasInProgressStage(stages []types.StageState) bool {
+	for _, stage := range stages {
+		if buildActivity(stage) == ActivityBuilding {
+			return true
+		}
+	}
+	return false
+}
+
+// previousStageStatus returns the status of the stage from the most recent finished execution of each of
+// its actions, which is a failure while any of them last failed. Only executions that are still running are
+// passed over, as retrying a failed stage runs it again within the same pipeline execution
+func previousStageStatus(history []types.ActionExecutionDetail, stage types.StageState) (LastBuildStatus, bool) {
+	actions := make(map[string]bool)
+	for _, action := range stage.ActionStates {
+		actions[actionName(action)] = true
+	}
+
+	seen := make(map[string]bool)
+	status := LastBuildStatusSuccess
+	for _, execution := range history {
+		name := aws.ToString(execution.ActionName)
+		if !isFinished(execution) || aws.ToString(execution.StageName) != stageName(stage) || seen[name] {
+			continue
+		}
+		// actions since removed from the stage no longer decide its status
+		if len(actions) > 0 && !actions[name] {
+			continue
+		}
+		seen[name] = true
+		if execution.Status == types.ActionExecutionStatusFailed {
+			status = LastBuildStatusFailure
+		}
+	}
+
+	return status, len(seen) > 0
+}
+
+// previousActionStatus returns the status of the most recent finished execution of the action
+// other than the one currently running
+func previousActionStatus(history []types.ActionExecutionDetail, stage types.StageState, action types.ActionState) (LastBuildStatus, bool) {
+	currentAction := ""
+	if action.LatestExecution != nil {
+		currentAction = aws.ToString(action.LatestExecution.ActionExecutionId)
+	}
+
+	for _, execution := range history {
+		if !isFinished(execution) ||
+			aws.ToString(execution.StageName) != stageName(stage) ||
+			aws.ToString(execution.ActionName) != actionName(action) ||
+			(currentAction != "" && aws.ToString(execution.ActionExecutionId) == currentAction) {
+			continue
+		}
+		if execution.Status == types.ActionExecutionStatusFailed {
+			return LastBuildStatusFailure, true
+		}
+		return LastBuildStatusSuccess, true
+	}
+
+	return LastBuildStatusUnknown, false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+)
+
+func actionExecutionDetail(pipelineExecutionID, stage, action string, status types.ActionExecutionStatus) types.ActionExecutionDetail {
+	return types.ActionExecutionDetail{
+		PipelineExecutionId: aws.String(pipelineExecutionID),
+		ActionExecutionId:   aws.String(pipelineExecutionID + "-" + action),
+		StageName:           aws.String(stage),
+		ActionName:          aws.String(action),
+		Status:              status,
+	}
+}
+
+func TestPreviousStageStatus(t *testing.T) {
+	history := []types.ActionExecutionDetail{
+		actionExecutionDetail("exec-3", "build", "compile", types.ActionExecutionStatusInProgress),
+		actionExecutionDetail("exec-2", "build", "compile", types.ActionExecutionStatusSucceeded),
+		actionExecutionDetail("exec-2", "build", "test", types.ActionExecutionStatusFailed),
+		actionExecutionDetail("exec-1", "build", "compile", types.ActionExecutionStatusSucceeded),
+		actionExecutionDetail("exec-1", "deploy", "release", types.ActionExecutionStatusSucceeded),
+	}
+
+	stage := types.StageState{
+		StageName: aws.String("build"),
+		LatestExecution: &types.StageExecution{
+			PipelineExecutionId: aws.String("exec-3"),
+			Status:              types.StageExecutionStatusInProgress,
+		},
+	}
+
+	status, ok := previousStageStatus(history, stage)
+	if !ok || status != LastBuildStatusFailure {
+		t.Errorf("previousStageStatus(build) is %s, %t not %s, true", status, ok, LastBuildStatusFailure)
+	}
+
+	stage.StageName = aws.String("deploy")
+	status, ok = previousStageStatus(history, stage)
+	if !ok || status != LastBuildStatusSuccess {
+		t.Errorf("previousStageStatus(deploy) is %s, %t not %s, true", status, ok, LastBuildStatusSuccess)
+	}
+
+	stage.StageName = aws.String("approve")
+	_, ok = previousStageStatus(history, stage)
+	if ok {
+		t.Errorf("previousStageStatus(approve) found a status without any history")
+	}
+
+	// retrying the failed stage runs it again within the same pipeline execution
+	retry := actionExecutionDetail("exec-2", "build", "test", types.ActionExecutionStatusInProgress)
+	retry.ActionExecutionId = aws.String("exec-2-test-retry")
+	history = []types.ActionExecutionDetail{
+		retry,
+		actionExecutionDetail("exec-2", "build", "compile", types.ActionExecutionStatusSucceeded),
+		actionExecutionDetail("exec-2", "build", "test", types.ActionExecutionStatusFailed),
+		actionExecutionDetail("exec-1", "build", "compile", types.ActionExecutionStatusSucceeded),
+		actionExecutionDetail("exec-1", "build", "test", types.ActionExecutionStatusSucceeded),
+	}
+	stage.StageName = aws.String("build")
+	stage.LatestExecution.PipelineExecutionId = aws.String("exec-2")
+	status, ok = previousStageStatus(history, stage)
+	if !ok || status != LastBuildStatusFailure {
+		t.Errorf("previousStageStatus(build) while retrying is %s, %t not %s, true", status, ok, LastBuildStatusFailure)
+	}
+
+	// once the retry passes the stage has nothing left failing
+	history[0].Status = types.ActionExecutionStatusSucceeded
+	status, ok = previousStageStatus(history, stage)
+	if !ok || status != LastBuildStatusSuccess {
+		t.Errorf("previousStageStatus(build) after retrying is %s, %t not %s, true", status, ok, LastBuildStatusSuccess)
+	}
+}
+
+func TestPreviousActionStatus(t *testing.T) {
+	history := []types.ActionExecutionDetail{
+		actionExecutionDetail("exec-3", "build", "test", types.ActionExecutionStatusInProgress),
+		actionExecutionDetail("exec-2", "build", "test", types.ActionExecutionStatusFailed),
+		actionExecutionDetail("exec-1", "build", "test", types.ActionExecutionStatusSucceeded),
+	}
+
+	stage := types.StageState{
+		StageName: aws.String("build"),
+		LatestExecution: &types.StageExecution{
+			PipelineExecutionId: aws.String("exec-3"),
+			Status:              types.StageExecutionStatusInProgress,
+		},
+	}
+	action := types.ActionState{
+		ActionName: aws.String("test"),
+		LatestExecution: &types.ActionExecution{
+			ActionExecutionId: aws.String("exec-3-test"),
+			Status:            types.ActionExecutionStatusInProgress,
+		},
+	}
+
+	status, ok := previousActionStatus(history, stage, action)
+	if !ok || status != LastBuildStatusFailure {
+		t.Errorf("previousActionStatus(test) is %s, %t not %s, true", status, ok, LastBuildStatusFailure)
+	}
+
+	// a retry of the failed action is within the same pipeline execution
+	stage.LatestExecution.PipelineExecutionId = aws.String("exec-2")
+	action.LatestExecution.ActionExecutionId = aws.String("exec-2-test-retry")
+	status, ok = previousActionStatus(history[1:], stage, action)
+	if !ok || status != LastBuildStatusFailure {
+		t.Errorf("previousActionStatus(test) while retrying is %s, %t not %s, true", status, ok, LastBuildStatusFailure)
+	}
+}
+
+func TestConvertKeepsPreviousStatusWhileBuilding(t *testing.T) {
+	pipelineState := PipelineState{
+		Name: "test-pipeline",
+		StageStates: []types.StageState{
+			types.StageState{
+				StageName: aws.String("build"),
+				LatestExecution: &types.StageExecution{
+					PipelineExecutionId: aws.String("exec-2"),
+					Status:              types.StageExecutionStatusInProgress,
+				},
+			},
+		},
+		History: []types.ActionExecutionDetail{
+			actionExecutionDetail("exec-1", "build", "compile", types.ActionExecutionStatusFailed),
+		},
+	}
+
+	for _, granularity := range []Granularity{GranularityPipeline, GranularityStage} {
+		projects := Convert([]PipelineState{pipelineState}, ConvertOptions{Granularity: granularity})
+		if projects[0].LastBuildStatus != LastBuildStatusFailure || projects[0].Activity != ActivityBuilding {
+			t.Errorf("Convert(%s) is %s, %s not %s, %s", granularity, projects[0].LastBuildStatus, projects[0].Activity, LastBuildStatusFailure, ActivityBuilding)
+		}
+	}
+}
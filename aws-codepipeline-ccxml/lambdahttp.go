@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandleFunctionURL serves the feed in response to a request to a Lambda Function URL
+func (s *FeedServer) HandleFunctionURL(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	headers := http.Header{}
+	for k, v := range request.Headers {
+		headers.Set(k, v)
+	}
+
+	response := s.serveLambda(ctx, request.RequestContext.HTTP.Method, request.RawPath, request.RawQueryString, headers, request.RequestContext.HTTP.SourceIP)
+	return events.LambdaFunctionURLResponse{
+		StatusCode: response.status,
+		Headers:    response.singleValueHeaders(),
+		Body:       response.body.String(),
+	}, nil
+}
+
+// HandleAPIGateway serves the feed in response to a request proxied by API Gateway
+func (s *FeedServer) HandleAPIGateway(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	headers := http.Header{}
+	for k, v := range request.Headers {
+		headers.Set(k, v)
+	}
+	for k, values := range request.MultiValueHeaders {
+		headers.Del(k)
+		for _, v := range values {
+			headers.Add(k, v)
+		}
+	}
+
+	query := url.Values{}
+	for k, v := range request.QueryStringParameters {
+		query.Set(k, v)
+	}
+	for k, values := range request.MultiValueQueryStringParameters {
+		query[k] = values
+	}
+
+	response := s.serveLambda(ctx, request.HTTPMethod, request.Path, query.Encode(), headers, request.RequestContext.Identity.SourceIP)
+	return events.APIGatewayProxyResponse{
+		StatusCode:        response.status,
+		MultiValueHeaders: response.header,
+		Body:              response.body.String(),
+	}, nil
+}
+
+// serveLambda serves a request received by the Lambda through the same handler as the HTTP server.
+// Once the request is authenticated the state of the pipelines is read first if it was last read longer
+// ago than the refresh interval, so that requests that are turned away cannot make the Lambda read it
+func (s *FeedServer) serveLambda(ctx context.Context, method string, path string, rawQuery string, headers http.Header, sourceIP string) *lambdaResponse {
+	response := &lambdaResponse{header: http.Header{}, status: http.StatusOK}
+	request, err := http.NewRequestWithContext(ctx, method, (&url.URL{Path: path, RawQuery: rawQuery}).String(), nil)
+	if err != nil {
+		http.Error(response, "invalid request", http.StatusBadRequest)
+		return response
+	}
+	request.Header = headers
+	request.RemoteAddr = sourceIP
+
+	routes := s.routes()
+	handler := withAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.RefreshIfStale()
+		routes.ServeHTTP(w, r)
+	}), s.authenticators)
+	handler.ServeHTTP(response, request)
+	return response
+}
+
+// lambdaResponse records the response to a request received by the Lambda
+type lambdaResponse struct {
+	header http.Header
+	status int
+	body   strings.Builder
+	wrote  bool
+}
+
+func (r *lambdaResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *lambdaResponse) WriteHeader(status int) {
+	if !r.wrote {
+		r.status = status
+		r.wrote = true
+	}
+}
+
+func (r *lambdaResponse) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+// singleValueHeaders joins the values of each header, as Function URL responses only have one value per header
+func (r *lambdaResponse) singleValueHeaders() map[string]string {
+	headers := make(map[string]string, len(r.header))
+	for k, values := range r.header {
+		headers[k] = strings.Join(values, ", ")
+	}
+	return headers
+}
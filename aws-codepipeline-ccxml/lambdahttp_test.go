@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func newTestFeedServer() *FeedServer {
+	stateProvider := &stubPipelineStateProvider{
+		pipelineStates: []PipelineState{PipelineState{Name: "service", Created: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	return &FeedServer{stateProvider: stateProvider, refresh: time.Hour}
+}
+
+func TestHandleFunctionURL(t *testing.T) {
+	server := newTestFeedServer()
+
+	request := events.LambdaFunctionURLRequest{RawPath: "/cc.xml"}
+	request.RequestContext.HTTP.Method = "GET"
+	response, err := server.HandleFunctionURL(context.Background(), request)
+	if err != nil {
+		t.Fatalf("HandleFunctionURL(...) returned %v", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("HandleFunctionURL(...) status is %d not %d", response.StatusCode, http.StatusOK)
+	}
+	if response.Headers["Content-Type"] != "application/xml" {
+		t.Errorf("HandleFunctionURL(...) Content-Type is %s not application/xml", response.Headers["Content-Type"])
+	}
+	if !strings.Contains(response.Body, `<Project name="service"`) {
+		t.Errorf("HandleFunctionURL(...) body is %s", response.Body)
+	}
+
+	request.Headers = map[string]string{"if-none-match": response.Headers["Etag"]}
+	response, err = server.HandleFunctionURL(context.Background(), request)
+	if err != nil {
+		t.Fatalf("HandleFunctionURL(...) returned %v", err)
+	}
+	if response.StatusCode != http.StatusNotModified || response.Body != "" {
+		t.Errorf("HandleFunctionURL(...) with a matching ETag is %d not %d", response.StatusCode, http.StatusNotModified)
+	}
+}
+
+func TestHandleAPIGateway(t *testing.T) {
+	server := newTestFeedServer()
+
+	response, err := server.HandleAPIGateway(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:        "GET",
+		Path:              "/cc.json",
+		MultiValueHeaders: map[string][]string{"Accept": []string{"application/json"}},
+	})
+	if err != nil {
+		t.Fatalf("HandleAPIGateway(...) returned %v", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("HandleAPIGateway(...) status is %d not %d", response.StatusCode, http.StatusOK)
+	}
+	if ct := response.MultiValueHeaders["Content-Type"]; len(ct) != 1 || ct[0] != "application/json" {
+		t.Errorf("HandleAPIGateway(...) Content-Type is %v not application/json", ct)
+	}
+	if !strings.Contains(response.Body, `"name":"service"`) {
+		t.Errorf("HandleAPIGateway(...) body is %s", response.Body)
+	}
+
+	response, err = server.HandleAPIGateway(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/missing"})
+	if err != nil {
+		t.Fatalf("HandleAPIGateway(...) returned %v", err)
+	}
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("HandleAPIGateway(...) of a missing path is %d not %d", response.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestHandleFunctionURLUnauthenticated(t *testing.T) {
+	server := newTestFeedServer()
+	server.authenticators = []Authenticator{&BearerAuthenticator{[]string{"token"}}}
+
+	request := events.LambdaFunctionURLRequest{RawPath: "/cc.xml"}
+	request.RequestContext.HTTP.Method = "GET"
+	response, err := server.HandleFunctionURL(context.Background(), request)
+	if err != nil {
+		t.Fatalf("HandleFunctionURL(...) returned %v", err)
+	}
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("HandleFunctionURL(...) without a token is %d not %d", response.StatusCode, http.StatusUnauthorized)
+	}
+	if !server.refreshed.IsZero() {
+		t.Errorf("HandleFunctionURL(...) read the pipelines for a request that was not authenticated")
+	}
+
+	request.Headers = map[string]string{"authorization": "Bearer token"}
+	response, err = server.HandleFunctionURL(context.Background(), request)
+	if err != nil {
+		t.Fatalf("HandleFunctionURL(...) returned %v", err)
+	}
+	if response.StatusCode != http.StatusOK || server.refreshed.IsZero() {
+		t.Errorf("HandleFunctionURL(...) with a token is %d and refreshed at %v", response.StatusCode, server.refreshed)
+	}
+}
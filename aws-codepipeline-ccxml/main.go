@@ -2,12 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -16,42 +27,449 @@ var (
 	key      = kingpin.Flag("key", "The S3 bucket key to write data to").Envar("KEY").Default("cc.xml").String()
 	file     = kingpin.Flag("file", "The file to write to").String()
 	isLambda = kingpin.Flag("lambda", "To run as a lambda").Default("true").Bool()
+	handler  = kingpin.Flag("handler", "The events the Lambda handles, CodePipeline events that update the feed (events) or requests for the feed from a Function URL (function-url) or API Gateway (api-gateway)").Envar("HANDLER").Default("events").Enum("events", "function-url", "api-gateway")
+	isServer = kingpin.Flag("serve", "To run as an HTTP server that serves the feed rather than writing it").Envar("SERVE").Bool()
+	listen   = kingpin.Flag("listen", "The address the HTTP server listens on").Envar("LISTEN").Default(":8080").String()
+	refresh  = kingpin.Flag("refresh", "How often the HTTP server reads the state of the pipelines").Envar("REFRESH").Default(DefaultRefresh.String()).Duration()
+
+	basicAuth        = kingpin.Flag("basic-auth", "A comma separated list of username:password credentials accepted by the served feed").Envar("BASIC_AUTH").String()
+	basicAuthFile    = kingpin.Flag("basic-auth-file", "A file of username:password credentials accepted by the served feed, one per line").Envar("BASIC_AUTH_FILE").String()
+	bearerTokens     = kingpin.Flag("bearer-tokens", "A comma separated list of bearer tokens accepted by the served feed").Envar("BEARER_TOKENS").String()
+	bearerTokensFile = kingpin.Flag("bearer-tokens-file", "A file of bearer tokens accepted by the served feed, one per line").Envar("BEARER_TOKENS_FILE").String()
+	allowCIDRs       = kingpin.Flag("allow-cidrs", "A comma separated list of networks the served feed accepts requests from, such as 10.0.0.0/8").Envar("ALLOW_CIDRS").String()
+
+	targets      = kingpin.Flag("targets", "A comma separated list of further s3://bucket/key URLs or files to also write the feed to").Envar("TARGETS").String()
+	targetPolicy = kingpin.Flag("target-policy", "Fail when the feed could not be written to any one target (all) or only when it could not be written to every target (best-effort)").Envar("TARGET_POLICY").Default(string(TargetPolicyAll)).Enum(string(TargetPolicyAll), string(TargetPolicyBestEffort))
+
+	badgePrefix       = kingpin.Flag("badge-prefix", "Write an SVG status badge for each project under this prefix, such as badges/").Envar("BADGE_PREFIX").String()
+	badgeCacheControl = kingpin.Flag("badge-cache-control", "The Cache-Control of the badges").Envar("BADGE_CACHE_CONTROL").Default(DefaultBadgeCacheControl).String()
+
+	dashboardName    = kingpin.Flag("dashboard", "Write an HTML dashboard of the projects alongside the feed with this name, such as index.html").Envar("DASHBOARD").String()
+	dashboardRefresh = kingpin.Flag("dashboard-refresh", "How often the dashboard reloads itself").Envar("DASHBOARD_REFRESH").Default(DefaultDashboardRefresh.String()).Duration()
+
+	atomName    = kingpin.Flag("atom", "Write an Atom feed of projects that were broken, fixed or are still failing alongside the feed with this name, such as transitions.atom").Envar("ATOM").String()
+	atomEntries = kingpin.Flag("atom-entries", "The number of transitions kept in the Atom feed").Envar("ATOM_ENTRIES").Default(strconv.Itoa(DefaultAtomEntries)).Int()
+
+	private        = kingpin.Flag("private", "Write the feed without a public ACL and return a pre-signed URL to it").Envar("PRIVATE").Bool()
+	presignExpiry  = kingpin.Flag("presign-expiry", "How long the pre-signed URL to a private feed is valid for").Envar("PRESIGN_EXPIRY").Default("12h").Duration()
+	presignParam   = kingpin.Flag("presign-parameter", "An SSM parameter that the pre-signed URL to a private feed is written to when it is rotated").Envar("PRESIGN_PARAMETER").String()
+	contentType    = kingpin.Flag("content-type", "The Content-Type of the S3 object at the bucket and key, defaulting to that of the format of the feed").Envar("CONTENT_TYPE").String()
+	cacheControl   = kingpin.Flag("cache-control", "The Cache-Control of the S3 object, such as max-age=60").Envar("CACHE_CONTROL").String()
+	encryption     = kingpin.Flag("sse", "The server-side encryption of the S3 object (default, AES256 or aws:kms)").Envar("SSE").Default("default").Enum("default", string(s3types.ServerSideEncryptionAes256), string(s3types.ServerSideEncryptionAwsKms))
+	kmsKeyID       = kingpin.Flag("sse-kms-key-id", "The KMS key used to encrypt the S3 object when using aws:kms").Envar("SSE_KMS_KEY_ID").String()
+	storageClass   = kingpin.Flag("storage-class", "The storage class of the S3 object, such as STANDARD or INTELLIGENT_TIERING").Envar("STORAGE_CLASS").String()
+	objectTags     = kingpin.Flag("object-tags", "A comma separated list of key=value tags for the S3 object").Envar("OBJECT_TAGS").String()
+	objectMetadata = kingpin.Flag("object-metadata", "A comma separated list of key=value metadata for the S3 object").Envar("OBJECT_METADATA").String()
+	gzipFeed       = kingpin.Flag("gzip", "Compress the feed with gzip, setting the Content-Encoding of the S3 object or also writing the file with a .gz extension").Envar("GZIP").Bool()
+	gzipOnly       = kingpin.Flag("gzip-only", "Write only the compressed file rather than alongside the uncompressed one").Envar("GZIP_ONLY").Bool()
+
+	regions      = kingpin.Flag("regions", "A comma separated list of regions to report on, defaulting to the configured region").Envar("REGIONS").String()
+	roles        = kingpin.Flag("roles", "A comma separated list of role ARNs, optionally as alias=arn, to assume to report on other accounts").Envar("ROLES").String()
+	externalID   = kingpin.Flag("external-id", "The external ID used when assuming roles").Envar("EXTERNAL_ID").String()
+	sessionName  = kingpin.Flag("session-name", "The session name used when assuming roles").Envar("SESSION_NAME").Default("ccxml").String()
+	concurrency  = kingpin.Flag("concurrency", "The number of pipelines whose state is fetched at the same time").Envar("CONCURRENCY").Default("10").Int()
+	pipelineTags = kingpin.Flag("pipeline-tags", "Read the tags of each pipeline, which are published in the JSON feed and can filter the served feed").Envar("PIPELINE_TAGS").Bool()
+
+	granularity         = kingpin.Flag("granularity", "Report a project per pipeline, stage or action").Envar("GRANULARITY").Default(string(GranularityPipeline)).Enum(string(GranularityPipeline), string(GranularityStage), string(GranularityAction))
+	separator           = kingpin.Flag("separator", "The separator placed between pipeline, stage and action names").Envar("SEPARATOR").Default(DefaultSeparator).String()
+	disabledTransitions = kingpin.Flag("disabled-transitions", "How to report stages behind a disabled transition (ignore or unknown)").Envar("DISABLED_TRANSITIONS").Default(string(TransitionTreatmentUnknown)).Enum(string(TransitionTreatmentIgnore), string(TransitionTreatmentUnknown))
+	regionNaming        = kingpin.Flag("region-naming", "Where to place the region in project names (none, prefix or suffix)").Envar("REGION_NAMING").Default(string(NamePlacementNone)).Enum(string(NamePlacementNone), string(NamePlacementPrefix), string(NamePlacementSuffix))
+	accountNaming       = kingpin.Flag("account-naming", "Where to place the account in project names (none, prefix or suffix)").Envar("ACCOUNT_NAMING").Default(string(NamePlacementPrefix)).Enum(string(NamePlacementNone), string(NamePlacementPrefix), string(NamePlacementSuffix))
 )
 
-func updateProjectsStatus(stateProvider PipelineStateProvider, persistenceProvider PersistenceProvider) error {
-	pipelineStates, err := stateProvider.GetPipelineState()
+func convertOptions() ConvertOptions {
+	return ConvertOptions{
+		Granularity:         Granularity(*granularity),
+		Separator:           *separator,
+		DisabledTransitions: TransitionTreatment(*disabledTransitions),
+		RegionNaming:        NamePlacement(*regionNaming),
+		AccountNaming:       NamePlacement(*accountNaming),
+	}
+}
+
+// splitList splits a comma separated flag value, ignoring empty entries
+func splitList(value string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// splitPairs splits a comma separated flag value of key=value pairs
+func splitPairs(value string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, pair := range splitList(value) {
+		i := strings.Index(pair, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid key=value pair %q", pair)
+		}
+		pairs[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return pairs, nil
+}
+
+func objectOptions() (ObjectOptions, error) {
+	tags, err := splitPairs(*objectTags)
+	if err != nil {
+		return ObjectOptions{}, fmt.Errorf("invalid object tags: %v", err)
+	}
+	metadata, err := splitPairs(*objectMetadata)
 	if err != nil {
-		return fmt.Errorf("unable to get state pipeline state: %v", err)
+		return ObjectOptions{}, fmt.Errorf("invalid object metadata: %v", err)
+	}
+
+	options := ObjectOptions{
+		ContentType:  *contentType,
+		CacheControl: *cacheControl,
+		KMSKeyID:     *kmsKeyID,
+		StorageClass: s3types.StorageClass(*storageClass),
+		Tags:         tags,
+		Metadata:     metadata,
+		Gzip:         *gzipFeed,
+	}
+	if *encryption != "default" {
+		options.Encryption = s3types.ServerSideEncryption(*encryption)
+	}
+	if !validStorageClass(options.StorageClass) {
+		return ObjectOptions{}, fmt.Errorf("invalid storage class %s", *storageClass)
+	}
+
+	return options, nil
+}
+
+// authenticators for the served feed, which only accepts requests from the allowed networks and, when
+// there are credentials or tokens, those carrying any one of them
+func authenticators() ([]Authenticator, error) {
+	authenticators := make([]Authenticator, 0)
+
+	if cidrs := splitList(*allowCIDRs); len(cidrs) > 0 {
+		networks, err := ParseCIDRs(cidrs)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, &CIDRAuthenticator{networks})
+	}
+
+	values := splitList(*basicAuth)
+	if *basicAuthFile != "" {
+		lines, err := readLines(*basicAuthFile)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, lines...)
+	}
+	tokens := splitList(*bearerTokens)
+	if *bearerTokensFile != "" {
+		lines, err := readLines(*bearerTokensFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, lines...)
+	}
+
+	credentials := AnyAuthenticator{}
+	if len(values) > 0 {
+		basic := &BasicAuthenticator{}
+		for _, value := range values {
+			credential, err := ParseCredential(value)
+			if err != nil {
+				return nil, err
+			}
+			basic.credentials = append(basic.credentials, credential)
+		}
+		credentials = append(credentials, basic)
+	}
+	if len(tokens) > 0 {
+		credentials = append(credentials, &BearerAuthenticator{tokens})
+	}
+	if len(credentials) > 0 {
+		authenticators = append(authenticators, credentials)
+	}
+
+	return authenticators, nil
+}
+
+// validStorageClass is true for the storage classes S3 knows of, or none to leave it to S3
+func validStorageClass(class s3types.StorageClass) bool {
+	if class == "" {
+		return true
+	}
+	for _, value := range class.Values() {
+		if class == value {
+			return true
+		}
+	}
+	return false
+}
+
+// withTargets adds the further targets, badges, dashboard and transitions to the primary persistence provider,
+// which the feed is read back from unless a JSON target holds more detail. Badges, the dashboard and transitions
+// are written alongside the primary feed
+func withTargets(cfg aws.Config, primary PersistenceProvider) (PersistenceProvider, error) {
+	values := splitList(*targets)
+	if len(values) == 0 && *badgePrefix == "" && *dashboardName == "" && *atomName == "" {
+		return primary, nil
 	}
 
-	err = persistenceProvider.PersistProjects(Convert(pipelineStates))
+	object, err := objectOptions()
 	if err != nil {
-		return fmt.Errorf("unable to persist projects data: %v", err)
+		return nil, err
 	}
+	// the Content-Type is only that of the primary feed, as further targets may be in another format
+	object.ContentType = ""
 
-	return nil
+	providers := []PersistenceProvider{primary}
+	for _, value := range values {
+		provider, err := parseTarget(cfg, value, object)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	if *badgePrefix != "" || *dashboardName != "" || *atomName != "" {
+		store, ok := primary.(ObjectStore)
+		if !ok {
+			return nil, fmt.Errorf("badges, dashboards and transitions cannot be written alongside %s", targetName(primary))
+		}
+		if *badgePrefix != "" {
+			providers = append(providers, &BadgePersistenceProvider{store, *badgePrefix, *badgeCacheControl, *concurrency})
+		}
+		if *dashboardName != "" {
+			providers = append(providers, &DashboardPersistenceProvider{store, *dashboardName, *dashboardRefresh, convertOptions()})
+		}
+		if *atomName != "" {
+			providers = append(providers, &AtomPersistenceProvider{store, *atomName, *atomEntries})
+		}
+	}
+
+	return newMultiPersistenceProvider(providers, TargetPolicy(*targetPolicy)), nil
+}
+
+// parseTarget parses an s3://bucket/key URL or a file name into the provider that writes to it
+func parseTarget(cfg aws.Config, value string, object ObjectOptions) (PersistenceProvider, error) {
+	if !strings.HasPrefix(value, "s3://") {
+		return &FilePersistenceProvider{value, FormatOf(value), *gzipFeed, *gzipOnly}, nil
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(value, "s3://"), "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid target %s, expected s3://bucket/key", value)
+	}
+	return &AWSS3PersistenceProvider{cfg, bucket, key, FormatOf(key), *private, object}, nil
+}
+
+// bestEffort treats a feed written to only some targets as written, logging the targets it failed on
+func bestEffort(status PersistStatus, err error) error {
+	var targetErr *MultiTargetError
+	if status != "" && errors.As(err, &targetErr) {
+		log.Printf("feed was not written to every target: %v", err)
+		return nil
+	}
+	return err
+}
+
+func pipelineStateProvider(cfg aws.Config) (PipelineStateProvider, error) {
+	accountRoles := make([]AccountRole, 0)
+	for _, value := range splitList(*roles) {
+		role, err := ParseAccountRole(value)
+		if err != nil {
+			return nil, err
+		}
+		accountRoles = append(accountRoles, role)
+	}
+
+	if len(accountRoles) > 0 {
+		return &CrossAccountPipelineStateProvider{cfg, accountRoles, *externalID, *sessionName, splitList(*regions), *concurrency, *pipelineTags}, nil
+	}
+	return newRegionalPipelineStateProvider(cfg, splitList(*regions), *concurrency, *pipelineTags), nil
+}
+
+// conflictRetries bounds how many times the feed is rebuilt, or the pipeline merged into it, when it keeps being updated concurrently
+const conflictRetries = 5
+
+// updateProjectsStatus rebuilds the feed from every pipeline. A feed that can be versioned is only
+// written if it is unchanged since before the pipelines were read, so that a rebuild cannot overwrite
+// a pipeline merged in the meantime with older state, and is only created if there is still none
+func updateProjectsStatus(stateProvider PipelineStateProvider, persistenceProvider PersistenceProvider, options ConvertOptions) (PersistStatus, error) {
+	versioned, isVersioned := persistenceProvider.(VersionedPersistenceProvider)
+
+	for attempt := 1; ; attempt++ {
+		var version string
+		if isVersioned {
+			var err error
+			// a feed that cannot be decoded still has a version to overwrite it at
+			_, version, err = versioned.ReadProjectsVersion()
+			if err != nil && version == "" && !errors.Is(err, ErrObjectNotFound) {
+				return "", fmt.Errorf("unable to read projects data: %v", err)
+			}
+		}
+
+		pipelineStates, err := stateProvider.GetPipelineState()
+		var partialErr *PartialError
+		if err != nil && !errors.As(err, &partialErr) {
+			return "", fmt.Errorf("unable to get state pipeline state: %v", err)
+		}
+		projects := Convert(pipelineStates, options)
+
+		var status PersistStatus
+		if isVersioned {
+			status, err = versioned.PersistProjectsVersion(projects, version)
+			if errors.Is(err, ErrVersionConflict) && attempt < conflictRetries {
+				log.Printf("rebuilding feed again as it was updated concurrently")
+				continue
+			}
+		} else {
+			status, err = persistenceProvider.PersistProjects(projects)
+		}
+		err = bestEffort(status, err)
+		if err != nil {
+			return "", fmt.Errorf("unable to persist projects data: %v", err)
+		}
+
+		// the feed has been written but the run is still reported as failed
+		if partialErr != nil {
+			return status, partialErr
+		}
+
+		return status, nil
+	}
+}
+
+// updatePipelineStatus refreshes only the referenced pipeline within the persisted feed, falling back
+// to a full update when the feed cannot be read back or the pipeline cannot be refreshed on its own
+func updatePipelineStatus(stateProvider PipelineStateProvider, persistenceProvider PersistenceProvider, ref PipelineRef, options ConvertOptions) (PersistStatus, error) {
+	singleProvider, ok := stateProvider.(SinglePipelineStateProvider)
+	reader, readable := persistenceProvider.(ProjectsReader)
+	if ref.Name == "" || !ok || !readable {
+		return updateProjectsStatus(stateProvider, persistenceProvider, options)
+	}
+
+	versioned, isVersioned := persistenceProvider.(VersionedPersistenceProvider)
+
+	for attempt := 1; ; attempt++ {
+		var existing []Project
+		var version string
+		var err error
+		if isVersioned {
+			existing, version, err = versioned.ReadProjectsVersion()
+		} else {
+			existing, err = reader.ReadProjects()
+		}
+		if err != nil {
+			log.Printf("rebuilding feed as the existing feed could not be read: %v", err)
+			return updateProjectsStatus(stateProvider, persistenceProvider, options)
+		}
+
+		// the pipeline is read on every attempt so the newest state is the one merged
+		pipelineState, stateErr := singleProvider.GetSinglePipelineState(ref)
+		var replacement []Project
+		var notFound *types.PipelineNotFoundException
+		switch {
+		case errors.Is(stateErr, ErrPipelineNotCovered):
+			log.Printf("ignoring pipeline %s in %s as it is not reported on", ref.Name, ref.Region)
+			return PersistStatusUnchanged, nil
+		case errors.As(stateErr, &notFound):
+			// the pipeline has been deleted so its projects are removed
+		default:
+			replacement = Convert([]PipelineState{pipelineState}, options)
+		}
+
+		projects := ReplacePipelineProjects(existing, pipelineState, replacement, options)
+
+		var status PersistStatus
+		if isVersioned {
+			status, err = versioned.PersistProjectsVersion(projects, version)
+			if errors.Is(err, ErrVersionConflict) && attempt < conflictRetries {
+				log.Printf("merging pipeline %s again as the feed was updated concurrently", ref.Name)
+				continue
+			}
+		} else {
+			status, err = persistenceProvider.PersistProjects(projects)
+		}
+		err = bestEffort(status, err)
+		if err != nil {
+			return "", fmt.Errorf("unable to persist projects data: %v", err)
+		}
+
+		if stateErr != nil && notFound == nil {
+			return status, &PipelineError{ref.Name, stateErr}
+		}
+
+		return status, nil
+	}
 }
 
 // HandleRequest is triggered when the Lambda receives an event
-func HandleRequest(ctx context.Context, event events.CodePipelineEvent) (string, error) {
+func HandleRequest(ctx context.Context, event events.EventBridgeEvent) (string, error) {
+	options := convertOptions()
+
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	psp := AWSPipelineStateProvider{cfg}
-	s3pp := AWSS3PersistenceProvider{cfg, *bucket, *key}
+	object, err := objectOptions()
+	if err != nil {
+		return "", err
+	}
+	s3pp := AWSS3PersistenceProvider{cfg, *bucket, *key, FormatOf(*key), *private, object}
 
-	err = updateProjectsStatus(&psp, &s3pp)
+	psp, err := pipelineStateProvider(cfg)
 	if err != nil {
 		return "", err
 	}
 
-	return "Done", nil
+	persistenceProvider, err := withTargets(cfg, &s3pp)
+	if err != nil {
+		return "", err
+	}
+
+	var status PersistStatus
+	if IsScheduledEvent(event) {
+		// pipelines in other regions and accounts raise events that never reach this Lambda, so
+		// a schedule rebuilds the feed from every pipeline, which also rotates the pre-signed URL
+		status, err = updateProjectsStatus(psp, persistenceProvider, options)
+	} else {
+		ref, routeErr := RouteEvent(event, options)
+		if routeErr != nil {
+			log.Print(routeErr)
+			return "Ignored", nil
+		}
+		status, err = updatePipelineStatus(psp, persistenceProvider, ref, options)
+	}
+	// a feed written while some pipelines could not be read still has its URL rotated before the error is returned
+	if err != nil && status == "" {
+		return "", err
+	}
+	updateErr := err
+
+	if *private {
+		url, err := s3pp.PresignURL(*presignExpiry)
+		if err != nil {
+			return "", err
+		}
+
+		// the URL is only published by a schedule, as SSM throttles writes far below the rate of events
+		if *presignParam != "" && IsScheduledEvent(event) {
+			err = PublishParameter(cfg, *presignParam, url)
+			if err != nil {
+				return "", err
+			}
+			log.Printf("pre-signed URL valid for %s written to %s", *presignExpiry, *presignParam)
+		}
+		return url, updateErr
+	}
+
+	return string(status), updateErr
 }
 
 func runLocally() error {
 	var persistenceProvider PersistenceProvider
+	var s3pp *AWSS3PersistenceProvider
 
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
@@ -59,19 +477,115 @@ func runLocally() error {
 	}
 
 	if *file != "" {
-		persistenceProvider = &FilePersistenceProvider{*file}
+		persistenceProvider = &FilePersistenceProvider{*file, FormatOf(*file), *gzipFeed, *gzipOnly}
 	} else {
 		if *bucket == "" || *key == "" {
 			log.Fatal("must either specify the bucket name and key or file")
 		}
 
-		persistenceProvider = &AWSS3PersistenceProvider{cfg, *bucket, *key}
+		object, err := objectOptions()
+		if err != nil {
+			return err
+		}
+		s3pp = &AWSS3PersistenceProvider{cfg, *bucket, *key, FormatOf(*key), *private, object}
+		persistenceProvider = s3pp
+	}
+
+	persistenceProvider, err = withTargets(cfg, persistenceProvider)
+	if err != nil {
+		return err
+	}
+
+	psp, err := pipelineStateProvider(cfg)
+	if err != nil {
+		return err
+	}
+
+	status, err := updateProjectsStatus(psp, persistenceProvider, convertOptions())
+	if err != nil && status == "" {
+		return err
+	}
+	updateErr := err
+	log.Printf("feed %s", strings.ToLower(string(status)))
+
+	if s3pp != nil && *private {
+		url, err := s3pp.PresignURL(*presignExpiry)
+		if err != nil {
+			return err
+		}
+		if *presignParam != "" {
+			err = PublishParameter(cfg, *presignParam, url)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Println(url)
+	}
+
+	return updateErr
+}
+
+func newFeedServer(cfg aws.Config) (*FeedServer, error) {
+	psp, err := pipelineStateProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := authenticators()
+	if err != nil {
+		return nil, err
 	}
+	return &FeedServer{stateProvider: psp, options: convertOptions(), refresh: *refresh, dashboardRefresh: *dashboardRefresh, authenticators: auth, tags: *pipelineTags}, nil
+}
 
-	psp := AWSPipelineStateProvider{cfg}
+// startFeedLambda serves the feed in response to requests from a Function URL or API Gateway
+func startFeedLambda() error {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return err
+	}
 
-	err = updateProjectsStatus(&psp, persistenceProvider)
+	server, err := newFeedServer(cfg)
+	if err != nil {
+		return err
+	}
+
+	if *handler == "api-gateway" {
+		lambda.Start(server.HandleAPIGateway)
+	} else {
+		lambda.Start(server.HandleFunctionURL)
+	}
+	return nil
+}
+
+// serve the feed over HTTP until interrupted, refreshing it in the background
+func serve() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	server, err := newFeedServer(cfg)
+	if err != nil {
+		return err
+	}
+	go server.Run(ctx)
+
+	httpServer := &http.Server{Addr: *listen, Handler: server.Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("serving the feed on %s", *listen)
+	err = httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
 	return err
 }
 
@@ -79,7 +593,17 @@ func main() {
 	kingpin.Version("0.1.0")
 	kingpin.Parse()
 
-	if *isLambda {
+	if *isServer {
+		err := serve()
+		if err != nil {
+			log.Fatalf("failed to serve project status: %v", err)
+		}
+	} else if *isLambda && *handler != "events" {
+		err := startFeedLambda()
+		if err != nil {
+			log.Fatalf("failed to serve project status: %v", err)
+		}
+	} else if *isLambda {
 		if *bucket == "" || *key == "" {
 			log.Fatal("must specify the bucket name and key")
 		}
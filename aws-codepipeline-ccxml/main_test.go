@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
+)
+
+type stubPipelineStateProvider struct {
+	pipelineStates []PipelineState
+	err            error
+	single         PipelineState
+	singleErr      error
+}
+
+func (p *stubPipelineStateProvider) GetPipelineState() ([]PipelineState, error) {
+	return p.pipelineStates, p.err
+}
+
+func (p *stubPipelineStateProvider) GetSinglePipelineState(ref PipelineRef) (PipelineState, error) {
+	return p.single, p.singleErr
+}
+
+type recordingPersistenceProvider struct {
+	projects []Project
+	existing []Project
+	readErr  error
+}
+
+func (p *recordingPersistenceProvider) PersistProjects(projects []Project) (PersistStatus, error) {
+	p.projects = projects
+	return PersistStatusWritten, nil
+}
+
+func (p *recordingPersistenceProvider) ReadProjects() ([]Project, error) {
+	return p.existing, p.readErr
+}
+
+func projectNames(projects []Project) []string {
+	names := make([]string, 0, len(projects))
+	for _, project := range projects {
+		names = append(names, project.Name)
+	}
+	return names
+}
+
+func TestUpdateProjectsStatusPartialFailure(t *testing.T) {
+	readErr := errors.New("AccessDeniedException")
+	pipelineErr := &PipelineError{"broken-pipeline", readErr}
+	stateProvider := &stubPipelineStateProvider{
+		pipelineStates: []PipelineState{
+			PipelineState{Name: "working-pipeline"},
+			PipelineState{Name: "broken-pipeline", Err: readErr},
+		},
+		err: &PartialError{[]*PipelineError{pipelineErr}, 2},
+	}
+	persistenceProvider := &recordingPersistenceProvider{}
+
+	_, err := updateProjectsStatus(stateProvider, persistenceProvider, ConvertOptions{})
+	if !errors.Is(err, readErr) {
+		t.Errorf("updateProjectsStatus(...) returned %v not the pipeline error", err)
+	}
+
+	if len(persistenceProvider.projects) != 2 {
+		t.Fatalf("updateProjectsStatus(...) persisted %d projects not 2", len(persistenceProvider.projects))
+	}
+	if persistenceProvider.projects[1].LastBuildStatus != LastBuildStatusUnknown {
+		t.Errorf("updateProjectsStatus(...) unreadable pipeline is %s not %s", persistenceProvider.projects[1].LastBuildStatus, LastBuildStatusUnknown)
+	}
+}
+
+func TestUpdateProjectsStatusFailure(t *testing.T) {
+	stateProvider := &stubPipelineStateProvider{err: errors.New("ThrottlingException")}
+	persistenceProvider := &recordingPersistenceProvider{}
+
+	_, err := updateProjectsStatus(stateProvider, persistenceProvider, ConvertOptions{})
+	if err == nil {
+		t.Errorf("updateProjectsStatus(...) did not return an error")
+	}
+	if persistenceProvider.projects != nil {
+		t.Errorf("updateProjectsStatus(...) persisted projects when no pipelines could be listed")
+	}
+}
+
+func TestUpdatePipelineStatus(t *testing.T) {
+	stageName := "build"
+	stateProvider := &stubPipelineStateProvider{
+		pipelineStates: []PipelineState{
+			PipelineState{
+				Name:        "full-rebuild",
+				StageStates: []types.StageState{types.StageState{StageName: &stageName}},
+			},
+		},
+		single: PipelineState{
+			Name:        "b",
+			StageStates: []types.StageState{types.StageState{StageName: &stageName}},
+		},
+	}
+	persistenceProvider := &recordingPersistenceProvider{
+		existing: []Project{
+			Project{Name: "a :: build"},
+			Project{Name: "b :: build"},
+			Project{Name: "b :: deploy"},
+			Project{Name: "c :: build"},
+		},
+	}
+	options := ConvertOptions{Granularity: GranularityStage}
+
+	_, err := updatePipelineStatus(stateProvider, persistenceProvider, PipelineRef{Name: "b"}, options)
+	if err != nil {
+		t.Fatalf("updatePipelineStatus(...) returned %v", err)
+	}
+
+	expected := []string{"a :: build", "b :: build", "c :: build"}
+	if !reflect.DeepEqual(projectNames(persistenceProvider.projects), expected) {
+		t.Errorf("updatePipelineStatus(...) persisted %v not %v", projectNames(persistenceProvider.projects), expected)
+	}
+
+	persistenceProvider.readErr = errors.New("NoSuchKey")
+	_, err = updatePipelineStatus(stateProvider, persistenceProvider, PipelineRef{Name: "b"}, options)
+	if err != nil {
+		t.Fatalf("updatePipelineStatus(...) returned %v", err)
+	}
+
+	expected = []string{"full-rebuild :: build"}
+	if !reflect.DeepEqual(projectNames(persistenceProvider.projects), expected) {
+		t.Errorf("updatePipelineStatus(...) with an unreadable feed persisted %v not %v", projectNames(persistenceProvider.projects), expected)
+	}
+
+	// a versioned primary target written along with a target that fails is written under best effort
+	primary := &versionedPersistenceProvider{recordingPersistenceProvider: recordingPersistenceProvider{existing: []Project{Project{Name: "a :: build"}}}}
+	targets := newMultiPersistenceProvider([]PersistenceProvider{primary, &stubTarget{name: "broken", err: errors.New("AccessDenied")}}, TargetPolicyBestEffort)
+	status, err := updatePipelineStatus(stateProvider, targets, PipelineRef{Name: "b"}, options)
+	if err != nil || status != PersistStatusWritten {
+		t.Errorf("updatePipelineStatus(...) with a failing target under best effort is %s %v", status, err)
+	}
+	expected = []string{"a :: build", "b :: build"}
+	if !reflect.DeepEqual(projectNames(primary.projects), expected) {
+		t.Errorf("updatePipelineStatus(...) persisted %v not %v", projectNames(primary.projects), expected)
+	}
+}
+
+func TestUpdatePipelineStatusDeletedPipeline(t *testing.T) {
+	stateProvider := &stubPipelineStateProvider{
+		single:    PipelineState{Name: "b"},
+		singleErr: &types.PipelineNotFoundException{},
+	}
+	persistenceProvider := &recordingPersistenceProvider{
+		existing: []Project{Project{Name: "a"}, Project{Name: "b"}},
+	}
+
+	_, err := updatePipelineStatus(stateProvider, persistenceProvider, PipelineRef{Name: "b"}, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("updatePipelineStatus(...) returned %v", err)
+	}
+
+	expected := []string{"a"}
+	if !reflect.DeepEqual(projectNames(persistenceProvider.projects), expected) {
+		t.Errorf("updatePipelineStatus(...) persisted %v not %v", projectNames(persistenceProvider.projects), expected)
+	}
+}
+
+// versionedPersistenceProvider rejects writes until the version it was read at has been written
+type versionedPersistenceProvider struct {
+	recordingPersistenceProvider
+	version   int
+	conflicts int
+	reads     int
+	// missing has nothing persisted until it is created
+	missing bool
+}
+
+func (p *versionedPersistenceProvider) ReadProjectsVersion() ([]Project, string, error) {
+	p.reads++
+	if p.missing {
+		return nil, "", ErrObjectNotFound
+	}
+	return p.existing, strconv.Itoa(p.version), nil
+}
+
+func (p *versionedPersistenceProvider) PersistProjectsVersion(projects []Project, version string) (PersistStatus, error) {
+	if p.conflicts > 0 {
+		p.conflicts--
+		p.version++
+		p.missing = false
+		return "", ErrVersionConflict
+	}
+	if p.missing {
+		if version != "" {
+			return "", ErrVersionConflict
+		}
+		p.missing = false
+		return p.PersistProjects(projects)
+	}
+	if version != strconv.Itoa(p.version) {
+		return "", ErrVersionConflict
+	}
+	return p.PersistProjects(projects)
+}
+
+func TestUpdatePipelineStatusConflict(t *testing.T) {
+	stateProvider := &stubPipelineStateProvider{single: PipelineState{Name: "b"}}
+	persistenceProvider := &versionedPersistenceProvider{
+		recordingPersistenceProvider: recordingPersistenceProvider{existing: []Project{Project{Name: "a"}}},
+		conflicts:                    2,
+	}
+
+	_, err := updatePipelineStatus(stateProvider, persistenceProvider, PipelineRef{Name: "b"}, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("updatePipelineStatus(...) returned %v", err)
+	}
+	if persistenceProvider.reads != 3 {
+		t.Errorf("updatePipelineStatus(...) read the feed %d times not 3", persistenceProvider.reads)
+	}
+
+	expected := []string{"a", "b"}
+	if !reflect.DeepEqual(projectNames(persistenceProvider.projects), expected) {
+		t.Errorf("updatePipelineStatus(...) persisted %v not %v", projectNames(persistenceProvider.projects), expected)
+	}
+
+	persistenceProvider.conflicts = conflictRetries
+	_, err = updatePipelineStatus(stateProvider, persistenceProvider, PipelineRef{Name: "b"}, ConvertOptions{})
+	if err == nil {
+		t.Errorf("updatePipelineStatus(...) did not give up after %d conflicts", conflictRetries)
+	}
+}
+
+func TestUpdateProjectsStatusVersioned(t *testing.T) {
+	stateProvider := &stubPipelineStateProvider{
+		pipelineStates: []PipelineState{PipelineState{Name: "a"}, PipelineState{Name: "b"}},
+	}
+
+	// a missing feed is only created while there is still none
+	persistenceProvider := &versionedPersistenceProvider{missing: true}
+	_, err := updateProjectsStatus(stateProvider, persistenceProvider, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("updateProjectsStatus(...) returned %v", err)
+	}
+	expected := []string{"a", "b"}
+	if !reflect.DeepEqual(projectNames(persistenceProvider.projects), expected) {
+		t.Errorf("updateProjectsStatus(...) persisted %v not %v", projectNames(persistenceProvider.projects), expected)
+	}
+
+	// a feed created or merged into while the pipelines are read is rebuilt again
+	persistenceProvider = &versionedPersistenceProvider{missing: true, conflicts: 1}
+	_, err = updateProjectsStatus(stateProvider, persistenceProvider, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("updateProjectsStatus(...) returned %v", err)
+	}
+	if persistenceProvider.reads != 2 {
+		t.Errorf("updateProjectsStatus(...) read the feed %d times not 2", persistenceProvider.reads)
+	}
+
+	persistenceProvider.conflicts = conflictRetries
+	_, err = updateProjectsStatus(stateProvider, persistenceProvider, ConvertOptions{})
+	if err == nil {
+		t.Errorf("updateProjectsStatus(...) did not give up after %d conflicts", conflictRetries)
+	}
+}
+
+func TestSplitPairs(t *testing.T) {
+	pairs, err := splitPairs("team=platform, env = production,empty=")
+	if err != nil {
+		t.Fatalf("splitPairs(...) returned %v", err)
+	}
+
+	expected := map[string]string{"team": "platform", "env": "production", "empty": ""}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("splitPairs(...) is %v not %v", pairs, expected)
+	}
+
+	_, err = splitPairs("team")
+	if err == nil {
+		t.Errorf("splitPairs(team) did not return an error")
+	}
+}
+
+func TestUpdateProjectsStatusBestEffort(t *testing.T) {
+	stateProvider := &stubPipelineStateProvider{
+		pipelineStates: []PipelineState{PipelineState{Name: "working-pipeline"}},
+	}
+	persistenceProvider := &MultiPersistenceProvider{
+		[]PersistenceProvider{
+			&stubTarget{name: "written", status: PersistStatusWritten},
+			&stubTarget{name: "broken", err: errors.New("AccessDenied")},
+		},
+		TargetPolicyBestEffort,
+	}
+
+	status, err := updateProjectsStatus(stateProvider, persistenceProvider, ConvertOptions{})
+	if err != nil {
+		t.Errorf("updateProjectsStatus(...) returned %v", err)
+	}
+	if status != PersistStatusWritten {
+		t.Errorf("updateProjectsStatus(...) status is %s not %s", status, PersistStatusWritten)
+	}
+
+	persistenceProvider.policy = TargetPolicyAll
+	_, err = updateProjectsStatus(stateProvider, persistenceProvider, ConvertOptions{})
+	if err == nil {
+		t.Errorf("updateProjectsStatus(...) did not return an error when a target failed")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	provider, err := parseTarget(aws.Config{}, "s3://bucket/path/cc.xml", ObjectOptions{})
+	if err != nil {
+		t.Fatalf("parseTarget(...) returned %v", err)
+	}
+	s3pp, ok := provider.(*AWSS3PersistenceProvider)
+	if !ok || s3pp.bucket != "bucket" || s3pp.key != "path/cc.xml" {
+		t.Errorf("parseTarget(...) is %v not s3://bucket/path/cc.xml", provider)
+	}
+
+	provider, err = parseTarget(aws.Config{}, "/var/www/cc.xml", ObjectOptions{})
+	if err != nil {
+		t.Fatalf("parseTarget(...) returned %v", err)
+	}
+	if fpp, ok := provider.(*FilePersistenceProvider); !ok || fpp.filename != "/var/www/cc.xml" {
+		t.Errorf("parseTarget(...) is %v not /var/www/cc.xml", provider)
+	}
+
+	_, err = parseTarget(aws.Config{}, "s3://bucket", ObjectOptions{})
+	if err == nil {
+		t.Errorf("parseTarget(s3://bucket) did not return an error")
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// PublishParameter writes a value to an SSM parameter as a SecureString, overwriting any earlier
+// value, such as the pre-signed URL of a private feed for the build monitor's configuration to read
+func PublishParameter(cfg aws.Config, name string, value string) error {
+	_, err := ssm.NewFromConfig(cfg).PutParameter(context.Background(), &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      ssmtypes.ParameterTypeSecureString,
+		Overwrite: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write SSM parameter %s: %v", name, err)
+	}
+	return nil
+}
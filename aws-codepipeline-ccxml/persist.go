@@ -1,21 +1,164 @@
 package main
 
 import (
-	"context"
-	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/google/renameio"
 )
 
 // PersistenceProvider allows the current project state to be persisted
 type PersistenceProvider interface {
-	PersistProjects(projects []Project) error
+	PersistProjects(projects []Project) (PersistStatus, error)
+}
+
+// PersistStatus describes the outcome of persisting the project state
+type PersistStatus string
+
+const (
+	// PersistStatusWritten is used when the project state was written
+	PersistStatusWritten PersistStatus = "Written"
+	// PersistStatusUnchanged is used when the project state was already persisted and so was not written again
+	PersistStatusUnchanged PersistStatus = "Unchanged"
+)
+
+// contentHashMetadata is the S3 object metadata holding the hash of the encoded projects
+const contentHashMetadata = "content-sha256"
+
+// ProjectsReader allows previously persisted project state to be read back
+type ProjectsReader interface {
+	ReadProjects() ([]Project, error)
+}
+
+// VersionedPersistenceProvider allows the project state to be read and then written back only if no one
+// else has written it in the meantime, so concurrent updates cannot overwrite fresher state
+type VersionedPersistenceProvider interface {
+	// ReadProjectsVersion returns the persisted projects along with an opaque version. The version is empty,
+	// with ErrObjectNotFound, when nothing has been persisted, and is still returned when the projects cannot be decoded
+	ReadProjectsVersion() ([]Project, string, error)
+	// PersistProjectsVersion writes the projects if the persisted version is unchanged, or returns ErrVersionConflict.
+	// An empty version only writes the projects when nothing has been persisted
+	PersistProjectsVersion(projects []Project, version string) (PersistStatus, error)
+}
+
+// ErrVersionConflict is returned when the persisted projects changed after they were read
+var ErrVersionConflict = errors.New("persisted projects changed since they were read")
+
+// ObjectWriter writes named content alongside the feed, such as a badge
+type ObjectWriter interface {
+	WriteObject(name string, content []byte, contentType string, cacheControl string) (PersistStatus, error)
+}
+
+// ObjectReader reads named content previously written alongside the feed
+type ObjectReader interface {
+	// ReadObject returns the content, or ErrObjectNotFound when it has not been written
+	ReadObject(name string) ([]byte, error)
+}
+
+// ObjectStore reads and writes named content alongside the feed
+type ObjectStore interface {
+	ObjectReader
+	ObjectWriter
+}
+
+// ErrObjectNotFound is returned when named content has not been written
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectOptions controls the metadata of the S3 object holding the feed
+type ObjectOptions struct {
+	// ContentType overrides the Content-Type of the format of the feed
+	ContentType  string
+	CacheControl string
+	// Encryption is the server-side encryption used, defaulting to the bucket's default encryption
+	Encryption types.ServerSideEncryption
+	// KMSKeyID is the KMS key used when Encryption is aws:kms, defaulting to the AWS managed key
+	KMSKeyID string
+	// StorageClass of the object, defaulting to STANDARD
+	StorageClass types.StorageClass
+	Tags         map[string]string
+	Metadata     map[string]string
+	// Gzip compresses the object and sets its Content-Encoding, which HTTP clients undo transparently
+	Gzip bool
+}
+
+// apply sets the configured metadata on the object being written
+func (o ObjectOptions) apply(input *s3.PutObjectInput) {
+	if o.ContentType != "" {
+		input.ContentType = aws.String(o.ContentType)
+	}
+	if o.CacheControl != "" {
+		input.CacheControl = aws.String(o.CacheControl)
+	}
+	if o.Gzip {
+		input.ContentEncoding = aws.String(gzipEncoding)
+	}
+	if o.Encryption != "" {
+		input.ServerSideEncryption = o.Encryption
+	}
+	if o.Encryption == types.ServerSideEncryptionAwsKms && o.KMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(o.KMSKeyID)
+	}
+	if o.StorageClass != "" {
+		input.StorageClass = o.StorageClass
+	}
+	if len(o.Tags) > 0 {
+		tags := url.Values{}
+		for k, v := range o.Tags {
+			tags.Set(k, v)
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+	for k, v := range o.Metadata {
+		input.Metadata[k] = v
+	}
+}
+
+// gzipEncoding is the Content-Encoding of gzip compressed objects
+const gzipEncoding = "gzip"
+
+// encodeProjects streams the projects encoded in the format to w, compressing them with gzip if compress is set
+func encodeProjects(projects []Project, w io.Writer, format Format, compress bool) error {
+	if !compress {
+		return EncodeFormat(projects, w, format)
+	}
+
+	zw := gzip.NewWriter(w)
+	err := EncodeFormat(projects, zw, format)
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// decodeProjects decodes projects in the format from r, decompressing them with gzip if compressed is set
+func decodeProjects(r io.Reader, format Format, compressed bool) ([]Project, error) {
+	if !compressed {
+		return DecodeFormat(r, format)
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return DecodeFormat(zr, format)
 }
 
 // AWSS3PersistenceProvider persists the current project state to S3
@@ -23,42 +166,329 @@ type AWSS3PersistenceProvider struct {
 	config aws.Config
 	bucket string
 	key    string
+	format Format
+	// private leaves the object without a public ACL, so it can only be read using a pre-signed URL
+	private bool
+	object  ObjectOptions
+}
+
+func (p *AWSS3PersistenceProvider) String() string {
+	return fmt.Sprintf("s3://%s/%s", p.bucket, p.key)
 }
 
-// PersistProjects to an S3 bucket
-func (p *AWSS3PersistenceProvider) PersistProjects(projects []Project) error {
+func (p *AWSS3PersistenceProvider) feedFormat() Format {
+	return p.format
+}
+
+// PersistProjects to an S3 bucket, unless the object already holds the same projects
+func (p *AWSS3PersistenceProvider) PersistProjects(projects []Project) (PersistStatus, error) {
+	return p.persistProjects(projects, nil)
+}
+
+// PersistProjectsVersion to an S3 bucket, if the object still has the ETag it had when it was read or,
+// given no ETag, if there is still no object
+func (p *AWSS3PersistenceProvider) PersistProjectsVersion(projects []Project, version string) (PersistStatus, error) {
+	return p.persistProjects(projects, &version)
+}
+
+func (p *AWSS3PersistenceProvider) persistProjects(projects []Project, version *string) (PersistStatus, error) {
+	// the compressed projects are all that is buffered, as the body must be seekable to be signed
 	var b bytes.Buffer
-	Encode(projects, bufio.NewWriter(&b))
+	err := encodeProjects(projects, &b, p.format, p.object.Gzip)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode projects: %v", err)
+	}
+
+	return p.putObject(p.key, b.Bytes(), p.format.ContentType(), p.object, version)
+}
+
+// putObject writes the content to the key unless the object already holds the same content and metadata.
+// Given a version, the write is only made if the object still has that ETag, or an empty version if there is no object
+func (p *AWSS3PersistenceProvider) putObject(key string, content []byte, contentType string, object ObjectOptions, version *string) (PersistStatus, error) {
+	var acl types.ObjectCannedACL
+	if !p.private {
+		acl = types.ObjectCannedACLPublicRead
+	}
+	hash := objectHash(content, contentType, acl, object)
 
 	svc := s3.NewFromConfig(p.config)
 
+	// a missing or unreadable object is simply written
+	head, err := svc.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil && version != nil && aws.ToString(head.ETag) != *version {
+		return "", ErrVersionConflict
+	}
+	if err == nil && head.Metadata[contentHashMetadata] == hash {
+		return PersistStatusUnchanged, nil
+	}
+
 	input := &s3.PutObjectInput{
+		Bucket:      aws.String(p.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(content),
+		Metadata:    map[string]string{},
+		ContentType: aws.String(contentType),
+	}
+	object.apply(input)
+	input.Metadata[contentHashMetadata] = hash
+	input.ACL = acl
+
+	var optFns []func(*s3.Options)
+	if version != nil && *version == "" {
+		optFns = append(optFns, withCondition("If-None-Match", "*"))
+	} else if version != nil {
+		optFns = append(optFns, withCondition("If-Match", *version))
+	}
+
+	_, err = svc.PutObject(context.Background(), input, optFns...)
+	if isConditionFailure(err) {
+		return "", ErrVersionConflict
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to persist to S3 s3://%s/%s: %v", p.bucket, key, err)
+	}
+
+	return PersistStatusWritten, nil
+}
+
+// WriteObject writes content, such as a badge, to a key of the bucket using the object options of the feed
+func (p *AWSS3PersistenceProvider) WriteObject(name string, content []byte, contentType string, cacheControl string) (PersistStatus, error) {
+	object := p.object
+	object.ContentType = ""
+	object.Gzip = false
+	if cacheControl != "" {
+		object.CacheControl = cacheControl
+	}
+	return p.putObject(name, content, contentType, object, nil)
+}
+
+// withCondition makes a write conditional on the ETag of the object with If-Match, or on there being
+// no object with If-None-Match, which the vendored SDK does not yet expose on PutObjectInput
+func withCondition(header string, value string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue(header, value))
+	}
+}
+
+// isConditionFailure is true when S3 rejected a conditional write because the object changed
+func isConditionFailure(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return true
+		}
+	}
+	return false
+}
+
+// objectHash covers the metadata and ACL of an object as well as its content, so that a change to
+// them is written even when the content is unchanged
+func objectHash(content []byte, contentType string, acl types.ObjectCannedACL, object ObjectOptions) string {
+	return contentHash(append(content, fmt.Sprintf("%s %s %+v", contentType, acl, object)...))
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadObject reads content, such as a badge, from a key of the bucket
+func (p *AWSS3PersistenceProvider) ReadObject(name string) ([]byte, error) {
+	svc := s3.NewFromConfig(p.config)
+
+	resp, err := svc.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(name),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read from S3 s3://%s/%s: %v", p.bucket, name, err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read from S3 s3://%s/%s: %v", p.bucket, name, err)
+	}
+	return content, nil
+}
+
+// ReadProjects from an S3 bucket
+func (p *AWSS3PersistenceProvider) ReadProjects() ([]Project, error) {
+	projects, _, err := p.ReadProjectsVersion()
+	return projects, err
+}
+
+// ReadProjectsVersion from an S3 bucket, using the ETag of the object as the version
+func (p *AWSS3PersistenceProvider) ReadProjectsVersion() ([]Project, string, error) {
+	svc := s3.NewFromConfig(p.config)
+
+	resp, err := svc.GetObject(context.Background(), &s3.GetObjectInput{
 		Bucket: aws.String(p.bucket),
 		Key:    aws.String(p.key),
-		Body:   bytes.NewReader(b.Bytes()),
-		ACL:    types.ObjectCannedACLPublicRead,
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, "", fmt.Errorf("unable to read from S3 s3://%s/%s: %w", p.bucket, p.key, ErrObjectNotFound)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read from S3 s3://%s/%s: %v", p.bucket, p.key, err)
+	}
+	defer resp.Body.Close()
+
+	// the SDK does not undo the Content-Encoding itself
+	projects, err := decodeProjects(resp.Body, p.format, aws.ToString(resp.ContentEncoding) == gzipEncoding)
+	if err != nil {
+		return nil, aws.ToString(resp.ETag), fmt.Errorf("unable to decode S3 s3://%s/%s: %v", p.bucket, p.key, err)
 	}
 
-	_, err := svc.PutObject(context.Background(), input)
+	return projects, aws.ToString(resp.ETag), nil
+}
+
+// PresignURL returns a URL that allows the object to be read until it expires. The URL stops working
+// sooner if the credentials used to sign it expire first
+func (p *AWSS3PersistenceProvider) PresignURL(expiry time.Duration) (string, error) {
+	svc := s3.NewPresignClient(s3.NewFromConfig(p.config))
+
+	req, err := svc.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(p.key),
+	}, s3.WithPresignExpires(expiry))
 	if err != nil {
-		return fmt.Errorf("unable to persist to S3 s3://%s/%s: %v", p.bucket, p.key, err)
+		return "", fmt.Errorf("unable to pre-sign S3 s3://%s/%s: %v", p.bucket, p.key, err)
 	}
 
-	return nil
+	return req.URL, nil
 }
 
 // FilePersistenceProvider persists the current project state to a local file
 type FilePersistenceProvider struct {
 	filename string
+	format   Format
+	// gzip writes a gzip compressed copy of the feed to filename with a .gz extension
+	gzip bool
+	// gzipOnly writes just the compressed copy, and not filename itself
+	gzipOnly bool
 }
 
-// PersistProjects to a local file
-func (p *FilePersistenceProvider) PersistProjects(projects []Project) error {
-	var b bytes.Buffer
-	Encode(projects, bufio.NewWriter(&b))
-	err := renameio.WriteFile(p.filename, b.Bytes(), os.FileMode(0666))
+func (p *FilePersistenceProvider) String() string {
+	return p.filename
+}
+
+func (p *FilePersistenceProvider) feedFormat() Format {
+	return p.format
+}
+
+// gzipFilename is the name of the compressed copy of the feed
+func (p *FilePersistenceProvider) gzipFilename() string {
+	return p.filename + ".gz"
+}
+
+// PersistProjects to a local file, streaming them to the plain and compressed files at the same time
+func (p *FilePersistenceProvider) PersistProjects(projects []Project) (PersistStatus, error) {
+	var files []*renameio.PendingFile
+	defer func() {
+		for _, f := range files {
+			f.Cleanup()
+		}
+	}()
+
+	var writers []io.Writer
+	var zw *gzip.Writer
+	for _, filename := range p.filenames() {
+		f, err := renameio.TempFile("", filename)
+		if err != nil {
+			return "", fmt.Errorf("unable to write file %s: %v", filename, err)
+		}
+		err = f.Chmod(os.FileMode(0666))
+		if err != nil {
+			return "", fmt.Errorf("unable to write file %s: %v", filename, err)
+		}
+		files = append(files, f)
+
+		if filename == p.gzipFilename() {
+			zw = gzip.NewWriter(f)
+			writers = append(writers, zw)
+		} else {
+			writers = append(writers, f)
+		}
+	}
+
+	err := EncodeFormat(projects, io.MultiWriter(writers...), p.format)
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to encode projects: %v", err)
+	}
+
+	for i, f := range files {
+		err = f.CloseAtomicallyReplace()
+		if err != nil {
+			return "", fmt.Errorf("unable to write file %s: %v", p.filenames()[i], err)
+		}
+	}
+	return PersistStatusWritten, nil
+}
+
+// filenames that the feed is written to
+func (p *FilePersistenceProvider) filenames() []string {
+	switch {
+	case p.gzip && p.gzipOnly:
+		return []string{p.gzipFilename()}
+	case p.gzip:
+		return []string{p.filename, p.gzipFilename()}
+	default:
+		return []string{p.filename}
+	}
+}
+
+// WriteObject writes content, such as a badge, to a file relative to the directory of the feed
+func (p *FilePersistenceProvider) WriteObject(name string, content []byte, contentType string, cacheControl string) (PersistStatus, error) {
+	filename := filepath.Join(filepath.Dir(p.filename), filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(filename), os.FileMode(0777))
+	if err == nil {
+		err = renameio.WriteFile(filename, content, os.FileMode(0666))
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to write file %s: %v", filename, err)
+	}
+	return PersistStatusWritten, nil
+}
+
+// ReadObject reads content, such as a badge, from a file relative to the directory of the feed
+func (p *FilePersistenceProvider) ReadObject(name string) ([]byte, error) {
+	filename := filepath.Join(filepath.Dir(p.filename), filepath.FromSlash(name))
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s: %v", filename, err)
+	}
+	return content, nil
+}
+
+// ReadProjects from a local file, preferring the uncompressed file when both are written
+func (p *FilePersistenceProvider) ReadProjects() ([]Project, error) {
+	filename := p.filenames()[0]
+	f, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("unable to write file %s: %v", p.filename, err)
+		return nil, fmt.Errorf("unable to read file %s: %v", filename, err)
 	}
-	return nil
+	defer f.Close()
+
+	projects, err := decodeProjects(f, p.format, filename == p.gzipFilename())
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode file %s: %v", filename, err)
+	}
+
+	return projects, nil
 }
@@ -1,16 +1,25 @@
+//go:build integration
 // +build integration
 
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/config"
 )
 
 func TestFilePersistenceProvider(t *testing.T) {
@@ -29,9 +38,9 @@ func TestFilePersistenceProvider(t *testing.T) {
 		t.Fatalf("failed to create temporary file: %v", err)
 	}
 	defer os.Remove(file.Name())
-	fpp := FilePersistenceProvider{file.Name()}
+	fpp := FilePersistenceProvider{file.Name(), FormatXML, false, false}
 
-	err = fpp.PersistProjects(projects)
+	_, err = fpp.PersistProjects(projects)
 	if err != nil {
 		t.Fatalf("failed to persist project: %v", err)
 	}
@@ -48,6 +57,116 @@ func TestFilePersistenceProvider(t *testing.T) {
 	}
 }
 
+func TestAWSS3PersistenceProviderVersion(t *testing.T) {
+	bucket, ok := os.LookupEnv("TEST_BUCKET")
+	if !ok {
+		t.Fatalf("no test bucket specified")
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		t.Fatalf("unable to load AWS config: %v", err)
+	}
+
+	randBytes := make([]byte, 16)
+	rand.Read(randBytes)
+	key := "test" + hex.EncodeToString(randBytes) + ".xml"
+
+	s3pp := AWSS3PersistenceProvider{cfg, bucket, key, FormatXML, true, ObjectOptions{}}
+	projects := []Project{Project{Name: "test-project", LastBuildStatus: LastBuildStatusSuccess}}
+
+	_, version, err := s3pp.ReadProjectsVersion()
+	if !errors.Is(err, ErrObjectNotFound) || version != "" {
+		t.Fatalf("ReadProjectsVersion() of a missing object is %q %v not %v", version, err, ErrObjectNotFound)
+	}
+
+	status, err := s3pp.PersistProjectsVersion(projects, "")
+	if err != nil || status != PersistStatusWritten {
+		t.Fatalf("failed to create object: %s %v", status, err)
+	}
+
+	// another writer creating the object first is a conflict
+	_, err = s3pp.PersistProjectsVersion(append(projects, Project{Name: "other-project"}), "")
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("creating an object that exists returned %v not %v", err, ErrVersionConflict)
+	}
+
+	_, version, err = s3pp.ReadProjectsVersion()
+	if err != nil {
+		t.Fatalf("unable to read object: %v", err)
+	}
+	_, err = s3pp.PersistProjectsVersion(append(projects, Project{Name: "other-project"}), version)
+	if err != nil {
+		t.Errorf("writing an object at its version returned %v", err)
+	}
+	_, err = s3pp.PersistProjectsVersion(projects, version)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("writing an object at an old version returned %v not %v", err, ErrVersionConflict)
+	}
+}
+
+func TestFilePersistenceProviderGzip(t *testing.T) {
+	projects := []Project{
+		Project{
+			Name:            "test-project",
+			Activity:        ActivitySleeping,
+			LastBuildStatus: LastBuildStatusSuccess,
+		},
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), "test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "cc.xml")
+	fpp := FilePersistenceProvider{filename, FormatXML, true, false}
+	_, err = fpp.PersistProjects(projects)
+	if err != nil {
+		t.Fatalf("failed to persist project: %v", err)
+	}
+
+	plain, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	f, err := os.Open(filename + ".gz")
+	if err != nil {
+		t.Fatalf("failed to open compressed file: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("failed to read compressed file: %v", err)
+	}
+	compressed, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to decompress file: %v", err)
+	}
+	if !bytes.Equal(plain, compressed) {
+		t.Errorf(`compressed file did not match: got "%s" expected "%s"`, compressed, plain)
+	}
+
+	os.Remove(filename)
+	fpp = FilePersistenceProvider{filename, FormatXML, true, true}
+	_, err = fpp.PersistProjects(projects)
+	if err != nil {
+		t.Fatalf("failed to persist project: %v", err)
+	}
+	if _, err = os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("uncompressed file was written when only the compressed file was expected")
+	}
+
+	actual, err := fpp.ReadProjects()
+	if err != nil {
+		t.Fatalf("failed to read projects: %v", err)
+	}
+	if !reflect.DeepEqual(actual, projects) {
+		t.Errorf("ReadProjects() is %v not %v", actual, projects)
+	}
+}
+
 func TestAWSS3PersistenceProvider(t *testing.T) {
 	bucket, ok := os.LookupEnv("TEST_BUCKET")
 	if !ok {
@@ -73,20 +192,26 @@ func TestAWSS3PersistenceProvider(t *testing.T) {
 	rand.Read(randBytes)
 	key := "test" + hex.EncodeToString(randBytes) + ".xml"
 
-	s3pp := AWSS3PersistenceProvider{cfg, bucket, key}
+	s3pp := AWSS3PersistenceProvider{cfg, bucket, key, FormatXML, true, ObjectOptions{CacheControl: "max-age=60"}}
 
-	err = s3pp.PersistProjects(projects)
-	if err != nil {
-		t.Fatalf("failed to persist project: %v", err)
+	status, err := s3pp.PersistProjects(projects)
+	if err != nil || status != PersistStatusWritten {
+		t.Fatalf("failed to persist project: %s %v", status, err)
 	}
 
-	expected := `<Projects><Project name="test-project" activity="Building" lastBuildStatus="Success" lastBuildTime="2019-01-01T00:00:00Z" webUrl="https://acme.com/build"></Project></Projects>`
+	status, err = s3pp.PersistProjects(projects)
+	if err != nil || status != PersistStatusUnchanged {
+		t.Errorf("persisting the same projects again was %s %v not %s", status, err, PersistStatusUnchanged)
+	}
 
-	svc := s3.New(cfg)
+	expected := `<Projects><Project name="test-project" activity="Building" lastBuildStatus="Success" lastBuildTime="2019-01-01T00:00:00Z" webUrl="https://acme.com/build"></Project></Projects>`
 
-	req := svc.GetObjectRequest(&s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	url, err := s3pp.PresignURL(time.Minute)
+	if err != nil {
+		t.Fatalf("unable to pre-sign object: %v", err)
+	}
 
-	resp, err := req.Send()
+	resp, err := http.Get(url)
 	if err != nil {
 		t.Fatalf("unable to read object from bucket: %v", err)
 	}
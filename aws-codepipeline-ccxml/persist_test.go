@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestObjectOptionsApply(t *testing.T) {
+	options := ObjectOptions{
+		CacheControl: "max-age=60",
+		Encryption:   types.ServerSideEncryptionAwsKms,
+		KMSKeyID:     "alias/ccxml",
+		StorageClass: types.StorageClassIntelligentTiering,
+		Tags:         map[string]string{"team": "platform", "cost centre": "123"},
+		Metadata:     map[string]string{"owner": "platform"},
+	}
+
+	input := &s3.PutObjectInput{Metadata: map[string]string{}}
+	options.apply(input)
+
+	if input.ContentType != nil {
+		t.Errorf("apply(...) content type is %s when none was configured", aws.ToString(input.ContentType))
+	}
+	if aws.ToString(input.CacheControl) != "max-age=60" {
+		t.Errorf("apply(...) cache control is %s not max-age=60", aws.ToString(input.CacheControl))
+	}
+	if input.ServerSideEncryption != types.ServerSideEncryptionAwsKms || aws.ToString(input.SSEKMSKeyId) != "alias/ccxml" {
+		t.Errorf("apply(...) encryption is %s with key %s", input.ServerSideEncryption, aws.ToString(input.SSEKMSKeyId))
+	}
+	if input.StorageClass != types.StorageClassIntelligentTiering {
+		t.Errorf("apply(...) storage class is %s not %s", input.StorageClass, types.StorageClassIntelligentTiering)
+	}
+	if aws.ToString(input.Tagging) != "cost+centre=123&team=platform" {
+		t.Errorf("apply(...) tagging is %s", aws.ToString(input.Tagging))
+	}
+	if input.Metadata["owner"] != "platform" {
+		t.Errorf("apply(...) metadata is %v", input.Metadata)
+	}
+
+	input = &s3.PutObjectInput{Metadata: map[string]string{}}
+	ObjectOptions{KMSKeyID: "alias/ccxml"}.apply(input)
+	if input.ServerSideEncryption != "" || input.SSEKMSKeyId != nil || input.Tagging != nil || input.CacheControl != nil || input.StorageClass != "" {
+		t.Errorf("apply(...) set metadata that was not configured")
+	}
+}
+
+func TestObjectHash(t *testing.T) {
+	content := []byte("<Projects></Projects>")
+	public := objectHash(content, "application/xml", types.ObjectCannedACLPublicRead, ObjectOptions{})
+
+	if objectHash(content, "application/xml", types.ObjectCannedACLPublicRead, ObjectOptions{}) != public {
+		t.Errorf("objectHash(...) of the same object differs")
+	}
+	for name, hash := range map[string]string{
+		"private":       objectHash(content, "application/xml", "", ObjectOptions{}),
+		"content type":  objectHash(content, "text/xml", types.ObjectCannedACLPublicRead, ObjectOptions{}),
+		"cache control": objectHash(content, "application/xml", types.ObjectCannedACLPublicRead, ObjectOptions{CacheControl: "max-age=60"}),
+	} {
+		if hash == public {
+			t.Errorf("objectHash(...) with a different %s is unchanged", name)
+		}
+	}
+}
+
+func TestEncodeProjectsGzip(t *testing.T) {
+	projects := []Project{
+		Project{
+			Name:            "test-project",
+			Activity:        ActivitySleeping,
+			LastBuildStatus: LastBuildStatusSuccess,
+		},
+	}
+
+	var b bytes.Buffer
+	err := encodeProjects(projects, &b, FormatXML, true)
+	if err != nil {
+		t.Fatalf("encodeProjects(...) returned %v", err)
+	}
+
+	_, err = gzip.NewReader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("encodeProjects(...) did not compress the projects: %v", err)
+	}
+
+	actual, err := decodeProjects(&b, FormatXML, true)
+	if err != nil {
+		t.Fatalf("decodeProjects(...) returned %v", err)
+	}
+	if !reflect.DeepEqual(actual, projects) {
+		t.Errorf("decodeProjects(...) is %v not %v", actual, projects)
+	}
+}
@@ -1,54 +1,362 @@
 package main
 
 import (
-	"time"
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
 	"github.com/aws/aws-sdk-go-v2/service/codepipeline/types"
 )
 
+// historySize is the number of recent action executions searched for the previous status of a stage
+const historySize = 100
+
 // PipelineState captures the current state of a pipeline
 type PipelineState struct {
-	Name        string
-	Created     time.Time
-	Region      string
+	Name    string
+	Created time.Time
+	Region  string
+	// Account is the ID or alias of the account the pipeline belongs to, when reporting on several accounts
+	Account     string
 	StageStates []types.StageState
+	// History holds recent action executions, newest first, and is only populated while a stage is in progress
+	History []types.ActionExecutionDetail
+	// Tags are those of the pipeline, which are only read when asked for
+	Tags map[string]string
+	// Err is set when the state of the pipeline could not be read
+	Err error
 }
 
 // PipelineStateProvider provides access to the current state of a pipeline
 type PipelineStateProvider interface {
-	// GetPipelineState returns the current state of a pipeline
+	// GetPipelineState returns the current state of a pipeline. When only some pipelines
+	// could not be read the states of all pipelines are returned along with a *PartialError
 	GetPipelineState() ([]PipelineState, error)
 }
 
+// PipelineRef identifies a single pipeline, such as the one named in a CodePipeline event
+type PipelineRef struct {
+	Name      string
+	Region    string
+	AccountID string
+}
+
+// ErrPipelineNotCovered is returned when a provider does not report on the referenced pipeline
+var ErrPipelineNotCovered = errors.New("pipeline is not reported on")
+
+// SinglePipelineStateProvider provides access to the current state of a single pipeline
+type SinglePipelineStateProvider interface {
+	// GetSinglePipelineState returns the current state of the referenced pipeline. When the state
+	// cannot be read the returned PipelineState still identifies the pipeline and records the error
+	GetSinglePipelineState(ref PipelineRef) (PipelineState, error)
+}
+
+// PipelineError records why the state of a single pipeline could not be read
+type PipelineError struct {
+	Name string
+	Err  error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// PartialError is returned when the state of some, but not all, pipelines could not be read
+type PartialError struct {
+	Errs  []*PipelineError
+	Total int
+}
+
+func (e *PartialError) Error() string {
+	messages := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("unable to read %d of %d pipelines: %s", len(e.Errs), e.Total, strings.Join(messages, "; "))
+}
+
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
 // AWSPipelineStateProvider provides access to the current state of a pipeline using the AWS API
 type AWSPipelineStateProvider struct {
 	config aws.Config
+	// concurrency is the number of pipelines whose state is fetched at the same time
+	concurrency int
+	// tags reads the tags of each pipeline along with its state
+	tags bool
 }
 
 // GetPipelineState provides access to the current state of a pipeline using the AWS API
 func (p *AWSPipelineStateProvider) GetPipelineState() ([]PipelineState, error) {
 	svc := codepipeline.NewFromConfig(p.config)
 
-	resp, err := svc.ListPipelines(context.Background(), &codepipeline.ListPipelinesInput{})
+	pipelines, err := listPipelines(svc)
 	if err != nil {
 		return nil, err
 	}
 
+	pipelineStates, errs := fetchConcurrently(len(pipelines), p.concurrency, func(i int) (PipelineState, error) {
+		return p.getPipelineState(svc, pipelines[i].Name)
+	})
+
+	// pipelines that cannot be read are still reported so the rest of the feed is written
+	failed := make([]*PipelineError, 0)
+	for i, err := range errs {
+		if err != nil {
+			pipelineStates[i] = PipelineState{
+				Name:    aws.ToString(pipelines[i].Name),
+				Created: aws.ToTime(pipelines[i].Created),
+				Region:  p.config.Region,
+				Err:     err,
+			}
+			failed = append(failed, &PipelineError{pipelineStates[i].Name, err})
+		}
+	}
+
+	if len(failed) > 0 {
+		return pipelineStates, &PartialError{failed, len(pipelines)}
+	}
+
+	return pipelineStates, nil
+}
+
+// MultiRegionPipelineStateProvider provides access to the current state of the pipelines in several regions
+type MultiRegionPipelineStateProvider struct {
+	config  aws.Config
+	regions []string
+	// concurrency is the number of pipelines whose state is fetched at the same time in each region
+	concurrency int
+	tags        bool
+}
+
+// GetPipelineState provides access to the current state of the pipelines in every region, in region order
+func (p *MultiRegionPipelineStateProvider) GetPipelineState() ([]PipelineState, error) {
+	regionStates := make([][]PipelineState, len(p.regions))
+	errs := make([]error, len(p.regions))
+
+	var wg sync.WaitGroup
+	for i, region := range p.regions {
+		wg.Add(1)
+		go func(i int, region string) {
+			defer wg.Done()
+			cfg := p.config.Copy()
+			cfg.Region = region
+			regionStates[i], errs[i] = (&AWSPipelineStateProvider{cfg, p.concurrency, p.tags}).GetPipelineState()
+		}(i, region)
+	}
+	wg.Wait()
+
+	return mergePipelineStates(p.regions, regionStates, errs)
+}
+
+// GetSinglePipelineState provides access to the current state of a single pipeline in one of the regions
+func (p *MultiRegionPipelineStateProvider) GetSinglePipelineState(ref PipelineRef) (PipelineState, error) {
+	for _, region := range p.regions {
+		if region == ref.Region {
+			cfg := p.config.Copy()
+			cfg.Region = region
+			return (&AWSPipelineStateProvider{cfg, p.concurrency, p.tags}).GetSinglePipelineState(ref)
+		}
+	}
+
+	return PipelineState{}, ErrPipelineNotCovered
+}
+
+// mergePipelineStates combines the states gathered from several sources, each identified by name,
+// into one list. Partial failures are combined along with the sources that could not be listed at all,
+// such as a region that is not enabled or a role that cannot be assumed, and the merge only fails
+// when no source could be listed
+func mergePipelineStates(sources []string, sourceStates [][]PipelineState, errs []error) ([]PipelineState, error) {
 	pipelineStates := make([]PipelineState, 0)
+	partial := &PartialError{}
+	unlisted := make([]string, 0)
+
+	for i, err := range errs {
+		var partialErr *PartialError
+		if err != nil && !errors.As(err, &partialErr) {
+			partial.Errs = append(partial.Errs, &PipelineError{sources[i], fmt.Errorf("unable to list pipelines: %w", err)})
+			unlisted = append(unlisted, fmt.Sprintf("%s: %v", sources[i], err))
+			continue
+		}
+		if partialErr != nil {
+			partial.Errs = append(partial.Errs, partialErr.Errs...)
+		}
+
+		pipelineStates = append(pipelineStates, sourceStates[i]...)
+	}
+
+	if len(unlisted) == len(sources) && len(sources) > 0 {
+		return nil, fmt.Errorf("unable to list pipelines in %s", strings.Join(unlisted, "; "))
+	}
+	if len(partial.Errs) > 0 {
+		// a source that could not be listed counts as one pipeline that could not be read
+		partial.Total = len(pipelineStates) + len(unlisted)
+		return pipelineStates, partial
+	}
+
+	return pipelineStates, nil
+}
+
+// GetSinglePipelineState provides access to the current state of a single pipeline using the AWS API
+func (p *AWSPipelineStateProvider) GetSinglePipelineState(ref PipelineRef) (PipelineState, error) {
+	if ref.Region != "" && ref.Region != p.config.Region {
+		return PipelineState{}, ErrPipelineNotCovered
+	}
+
+	pipelineState, err := p.getPipelineState(codepipeline.NewFromConfig(p.config), &ref.Name)
+	if err != nil {
+		return PipelineState{Name: ref.Name, Region: p.config.Region, Err: err}, err
+	}
 
-	for _, pipeline := range resp.Pipelines {
-		stageStates, err := svc.GetPipelineState(context.Background(), &codepipeline.GetPipelineStateInput{
-			Name: pipeline.Name,
-		})
+	return pipelineState, nil
+}
+
+func (p *AWSPipelineStateProvider) getPipelineState(svc *codepipeline.Client, name *string) (PipelineState, error) {
+	stageStates, err := svc.GetPipelineState(context.Background(), &codepipeline.GetPipelineStateInput{
+		Name: name,
+	})
+	if err != nil {
+		return PipelineState{}, err
+	}
+
+	var history []types.ActionExecutionDetail
+	if hasInProgressStage(stageStates.StageStates) {
+		history, err = getHistory(svc, name)
+		if err != nil {
+			return PipelineState{}, err
+		}
+	}
+
+	var tags map[string]string
+	if p.tags {
+		tags, err = getTags(svc, name)
+		if err != nil {
+			return PipelineState{}, err
+		}
+	}
+
+	return PipelineState{
+		Name:        aws.ToString(stageStates.PipelineName),
+		Created:     aws.ToTime(stageStates.Created),
+		Region:      p.config.Region,
+		StageStates: stageStates.StageStates,
+		History:     history,
+		Tags:        tags,
+	}, nil
+}
+
+// listPipelines returns every pipeline in the region, following pagination
+func listPipelines(svc *codepipeline.Client) ([]types.PipelineSummary, error) {
+	pipelines := make([]types.PipelineSummary, 0)
+
+	paginator := codepipeline.NewListPipelinesPaginator(svc, &codepipeline.ListPipelinesInput{})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
 		if err != nil {
 			return nil, err
 		}
+		pipelines = append(pipelines, resp.Pipelines...)
+	}
+
+	return pipelines, nil
+}
+
+// fetchConcurrently fetches the state of each of the pipelines with a bounded number of workers. Results
+// are written by index so the output order matches the order of the pipelines, whenever each finishes
+func fetchConcurrently(pipelines int, concurrency int, fetch func(i int) (PipelineState, error)) ([]PipelineState, []error) {
+	pipelineStates := make([]PipelineState, pipelines)
+	errs := make([]error, pipelines)
 
-		pipelineStates = append(pipelineStates, PipelineState{*pipeline.Name, *pipeline.Created, p.config.Region, stageStates.StageStates})
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers(concurrency, pipelines); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				pipelineStates[i], errs[i] = fetch(i)
+			}
+		}()
 	}
+	for i := 0; i < pipelines; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-	return pipelineStates, nil
+	return pipelineStates, errs
+}
+
+// workers bounds the configured concurrency to at least one worker and no more than there is work
+func workers(concurrency int, jobs int) int {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > jobs {
+		return jobs
+	}
+	return concurrency
+}
+
+// getHistory returns the most recent action executions of a pipeline, newest first
+func getHistory(svc *codepipeline.Client, name *string) ([]types.ActionExecutionDetail, error) {
+	resp, err := svc.ListActionExecutions(context.Background(), &codepipeline.ListActionExecutionsInput{
+		PipelineName: name,
+		MaxResults:   aws.Int32(historySize),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	history := resp.ActionExecutionDetails
+	sort.SliceStable(history, func(i, j int) bool {
+		return aws.ToTime(history[i].StartTime).After(aws.ToTime(history[j].StartTime))
+	})
+
+	return history, nil
+}
+
+// getTags returns the tags of a pipeline, which are listed by its ARN
+func getTags(svc *codepipeline.Client, name *string) (map[string]string, error) {
+	pipeline, err := svc.GetPipeline(context.Background(), &codepipeline.GetPipelineInput{
+		Name: name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pipeline.Metadata == nil {
+		return nil, fmt.Errorf("unable to find the ARN of pipeline %s", aws.ToString(name))
+	}
+
+	tags := make(map[string]string)
+	paginator := codepipeline.NewListTagsForResourcePaginator(svc, &codepipeline.ListTagsForResourceInput{
+		ResourceArn: pipeline.Metadata.PipelineArn,
+	})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range resp.Tags {
+			tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+
+	return tags, nil
 }
@@ -1,8 +1,10 @@
+//go:build integration
 // +build integration
 
 package main
 
 import (
+	"context"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -14,7 +16,7 @@ func TestAWSGetPipelineState(t *testing.T) {
 		t.Errorf("TestAWSGetPipelineState() unable to load AWS config: %v", err)
 	}
 
-	pipelineStateProvider := AWSPipelineStateProvider{cfg}
+	pipelineStateProvider := AWSPipelineStateProvider{cfg, 10, false}
 	pipelineStates, err := pipelineStateProvider.GetPipelineState()
 	if err != nil {
 		t.Errorf("TestAWSGetPipelineState() unable to retrieve pipeline states: %v", err)
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMergePipelineStates(t *testing.T) {
+	readErr := errors.New("ThrottlingException")
+	sources := []string{"eu-west-1", "us-east-1"}
+	sourceStates := [][]PipelineState{
+		[]PipelineState{PipelineState{Name: "a", Region: "eu-west-1"}},
+		[]PipelineState{PipelineState{Name: "b", Region: "us-east-1"}, PipelineState{Name: "c", Region: "us-east-1", Err: readErr}},
+	}
+	errs := []error{nil, &PartialError{[]*PipelineError{&PipelineError{"c", readErr}}, 2}}
+
+	pipelineStates, err := mergePipelineStates(sources, sourceStates, errs)
+
+	var partialErr *PartialError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("mergePipelineStates(...) returned %v not a partial error", err)
+	}
+	if partialErr.Total != 3 || len(partialErr.Errs) != 1 {
+		t.Errorf("mergePipelineStates(...) partial error is %d of %d not 1 of 3", len(partialErr.Errs), partialErr.Total)
+	}
+
+	expectedNames := []string{"a", "b", "c"}
+	if len(pipelineStates) != len(expectedNames) {
+		t.Fatalf("mergePipelineStates(...) returned %d states not %d", len(pipelineStates), len(expectedNames))
+	}
+	for index, pipelineState := range pipelineStates {
+		if pipelineState.Name != expectedNames[index] {
+			t.Errorf("mergePipelineStates(...) state %d is %s not %s", index, pipelineState.Name, expectedNames[index])
+		}
+	}
+
+	// the pipelines of the other sources are still reported when a source cannot be listed
+	pipelineStates, err = mergePipelineStates(sources, [][]PipelineState{sourceStates[0], nil}, []error{nil, readErr})
+	if !errors.As(err, &partialErr) || len(partialErr.Errs) != 1 || partialErr.Errs[0].Name != "us-east-1" || !errors.Is(err, readErr) {
+		t.Fatalf("mergePipelineStates(...) returned %v when a region could not be listed", err)
+	}
+	if partialErr.Total != 2 || len(pipelineStates) != 1 || pipelineStates[0].Name != "a" {
+		t.Errorf("mergePipelineStates(...) returned %v and %d of %d when a region could not be listed", pipelineStates, len(partialErr.Errs), partialErr.Total)
+	}
+
+	_, err = mergePipelineStates(sources, [][]PipelineState{nil, nil}, []error{readErr, readErr})
+	if err == nil || errors.As(err, &partialErr) {
+		t.Errorf("mergePipelineStates(...) returned %v when no region could be listed", err)
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	for _, test := range []struct {
+		concurrency int
+		jobs        int
+		expected    int
+	}{
+		{10, 100, 10},
+		{0, 100, 1},
+		{-5, 100, 1},
+		{10, 3, 3},
+		{10, 0, 0},
+	} {
+		if actual := workers(test.concurrency, test.jobs); actual != test.expected {
+			t.Errorf("workers(%d, %d) is %d not %d", test.concurrency, test.jobs, actual, test.expected)
+		}
+	}
+}
+
+func TestFetchConcurrently(t *testing.T) {
+	readErr := errors.New("ThrottlingException")
+	var running, most int32
+
+	pipelineStates, errs := fetchConcurrently(20, 3, func(i int) (PipelineState, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+
+		// earlier pipelines take longer, so they finish out of order
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		if i == 7 {
+			return PipelineState{}, readErr
+		}
+		return PipelineState{Name: strconv.Itoa(i)}, nil
+	})
+
+	if most > 3 {
+		t.Errorf("fetchConcurrently(...) ran %d fetches at the same time not at most 3", most)
+	}
+	if len(pipelineStates) != 20 || len(errs) != 20 {
+		t.Fatalf("fetchConcurrently(...) returned %d states and %d errors not 20", len(pipelineStates), len(errs))
+	}
+	for i, pipelineState := range pipelineStates {
+		if i == 7 {
+			if errs[i] != readErr {
+				t.Errorf("fetchConcurrently(...) error %d is %v not %v", i, errs[i], readErr)
+			}
+			continue
+		}
+		if pipelineState.Name != strconv.Itoa(i) || errs[i] != nil {
+			t.Errorf("fetchConcurrently(...) state %d is %s %v", i, pipelineState.Name, errs[i])
+		}
+	}
+
+	pipelineStates, errs = fetchConcurrently(0, 0, func(i int) (PipelineState, error) {
+		t.Errorf("fetchConcurrently(...) fetched a pipeline when there were none")
+		return PipelineState{}, nil
+	})
+	if len(pipelineStates) != 0 || len(errs) != 0 {
+		t.Errorf("fetchConcurrently(...) of no pipelines returned %d states", len(pipelineStates))
+	}
+}
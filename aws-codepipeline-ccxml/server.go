@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRefresh is how often the server reads the state of the pipelines
+const DefaultRefresh = time.Minute
+
+// maxCachedResponses bounds the responses to filtered requests held until the projects change
+const maxCachedResponses = 256
+
+// FeedServer serves the feed over HTTP from the projects it holds in memory, which are refreshed
+// in the background rather than when requested
+type FeedServer struct {
+	stateProvider PipelineStateProvider
+	options       ConvertOptions
+	refresh       time.Duration
+	// dashboardRefresh is how often the dashboard reloads itself
+	dashboardRefresh time.Duration
+	// authenticators must all accept a request before it is served
+	authenticators []Authenticator
+	// tags is true when the state provider reads the tags of the pipelines, without which nothing can be filtered by tag
+	tags bool
+
+	mu        sync.RWMutex
+	projects  []Project
+	ready     bool
+	refreshed time.Time
+	// changed is when the projects last changed, which a project removed or renamed does not show in its build times
+	changed time.Time
+	// generation counts the changes to the projects, so that responses rendered from earlier projects are not cached
+	generation uint64
+	// responses are rendered from the current projects, keyed by path and normalized filter
+	responses map[string]cachedResponse
+}
+
+// cachedResponse is the content rendered from the projects selected by a filter
+type cachedResponse struct {
+	projects []Project
+	content  []byte
+}
+
+// PersistProjects holds the projects in memory to be served
+func (s *FeedServer) PersistProjects(projects []Project) (PersistStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ready && reflect.DeepEqual(s.projects, projects) {
+		return PersistStatusUnchanged, nil
+	}
+	s.projects = projects
+	s.ready = true
+	s.changed = time.Now()
+	s.generation++
+	s.responses = nil
+	return PersistStatusWritten, nil
+}
+
+// ReadProjects held in memory
+func (s *FeedServer) ReadProjects() ([]Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.projects, nil
+}
+
+// Refresh reads the state of the pipelines into the projects being served. Projects refreshed while
+// some pipelines could not be read are still served, and are not refreshed again until the next interval
+func (s *FeedServer) Refresh() {
+	status, err := updateProjectsStatus(s.stateProvider, s, s.options)
+	var partialErr *PartialError
+	if errors.As(err, &partialErr) {
+		log.Printf("failed to refresh the status of some projects: %v", err)
+	} else if err != nil {
+		log.Printf("failed to refresh project status: %v", err)
+		return
+	}
+	log.Printf("feed %s", strings.ToLower(string(status)))
+
+	s.mu.Lock()
+	s.refreshed = time.Now()
+	s.mu.Unlock()
+}
+
+// RefreshIfStale reads the state of the pipelines when it was last read longer ago than the refresh interval,
+// for when the projects are refreshed as they are requested rather than in the background
+func (s *FeedServer) RefreshIfStale() {
+	s.mu.RLock()
+	stale := time.Since(s.refreshed) >= s.refreshInterval()
+	s.mu.RUnlock()
+
+	if stale {
+		s.Refresh()
+	}
+}
+
+func (s *FeedServer) refreshInterval() time.Duration {
+	if s.refresh <= 0 {
+		return DefaultRefresh
+	}
+	return s.refresh
+}
+
+// Run refreshes the projects straight away and then on every interval until the context is done.
+// A refresh that fails keeps serving the projects from the last one that did not
+func (s *FeedServer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.refreshInterval())
+	defer ticker.Stop()
+
+	for {
+		s.Refresh()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Handler serves the feed as /cc.xml and /cc.json, a badge for each project under /badges/
+// and the dashboard as /, to the requests that the authenticators accept. The feed and dashboard can be
+// filtered with the query parameters read by ParseProjectFilter
+func (s *FeedServer) Handler() http.Handler {
+	return withAuthentication(s.routes(), s.authenticators)
+}
+
+func (s *FeedServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cc.xml", s.serveFeed(FormatXML))
+	mux.HandleFunc("/cc.json", s.serveFeed(FormatJSON))
+	mux.HandleFunc("/badges/", s.serveBadge)
+	mux.HandleFunc("/", s.serveDashboard)
+	return mux
+}
+
+// current returns the projects to serve, or responds that there are none until the first refresh
+func (s *FeedServer) current(w http.ResponseWriter) ([]Project, bool) {
+	projects, _, ok := s.currentGeneration(w)
+	return projects, ok
+}
+
+func (s *FeedServer) currentGeneration(w http.ResponseWriter) ([]Project, uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.ready {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "the state of the pipelines has not been read yet", http.StatusServiceUnavailable)
+		return nil, 0, false
+	}
+	return s.projects, s.generation, true
+}
+
+func (s *FeedServer) serveFeed(format Format) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.serveFiltered(w, r, format.ContentType(), func(projects []Project, w io.Writer) error {
+			return EncodeFormat(projects, w, format)
+		})
+	}
+}
+
+// serveFiltered responds with the content rendered from the projects selected by the query, which
+// is cached until the projects change so that walls polling the same slice only render it once
+func (s *FeedServer) serveFiltered(w http.ResponseWriter, r *http.Request, contentType string, render func([]Project, io.Writer) error) {
+	filter, err := ParseProjectFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(filter.Tags) > 0 && !s.tags {
+		http.Error(w, "the tags of the pipelines are not read, so cannot be filtered on", http.StatusBadRequest)
+		return
+	}
+
+	projects, generation, ok := s.currentGeneration(w)
+	if !ok {
+		return
+	}
+
+	key := r.URL.Path + "?" + filter.Key()
+	if cached, ok := s.cachedResponse(key, generation); ok {
+		s.respond(w, r, cached.projects, cached.content, contentType, nil)
+		return
+	}
+
+	projects = filter.Apply(projects)
+	var b bytes.Buffer
+	err = render(projects, &b)
+	if err == nil {
+		s.cacheResponse(key, generation, cachedResponse{projects, b.Bytes()})
+	}
+	s.respond(w, r, projects, b.Bytes(), contentType, err)
+}
+
+func (s *FeedServer) cachedResponse(key string, generation uint64) (cachedResponse, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if generation != s.generation {
+		return cachedResponse{}, false
+	}
+	cached, ok := s.responses[key]
+	return cached, ok
+}
+
+func (s *FeedServer) cacheResponse(key string, generation uint64, response cachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a response rendered from projects that have since changed is not cached
+	if generation != s.generation {
+		return
+	}
+	if s.responses == nil || len(s.responses) >= maxCachedResponses {
+		s.responses = make(map[string]cachedResponse)
+	}
+	s.responses[key] = response
+}
+
+func (s *FeedServer) serveBadge(w http.ResponseWriter, r *http.Request) {
+	projects, ok := s.current(w)
+	if !ok {
+		return
+	}
+
+	// badges are found by the same name they are written to S3 with
+	badges := BadgePersistenceProvider{prefix: "/badges/"}
+	for _, project := range projects {
+		if badges.badgeName(project) == r.URL.Path {
+			var b bytes.Buffer
+			err := RenderBadge(project, &b)
+			s.respond(w, r, []Project{project}, b.Bytes(), BadgeContentType, err)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (s *FeedServer) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.serveFiltered(w, r, DashboardContentType, func(projects []Project, w io.Writer) error {
+		return RenderDashboard(projects, s.dashboardRefresh, s.options, w)
+	})
+}
+
+// respond with the content rendered from the projects, or 304 Not Modified when the client already has it,
+// so that polling build monitors cost almost nothing
+func (s *FeedServer) respond(w http.ResponseWriter, r *http.Request, projects []Project, content []byte, contentType string, err error) {
+	if err != nil {
+		log.Printf("failed to render %s: %v", r.URL.Path, err)
+		http.Error(w, "unable to render the feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+contentHash(content)+`"`)
+	http.ServeContent(w, r, "", s.lastModified(projects), bytes.NewReader(content))
+}
+
+// lastModified is the later of when the projects last changed and their newest last build time, so that
+// a change to the projects that leaves their build times alone is still seen as a modification
+func (s *FeedServer) lastModified(projects []Project) time.Time {
+	s.mu.RLock()
+	changed := s.changed
+	s.mu.RUnlock()
+
+	latest := lastBuildTime(projects)
+	if changed.After(latest) {
+		return changed
+	}
+	return latest
+}
+
+// lastBuildTime is the newest last build time of the projects, or zero when none can be parsed
+func lastBuildTime(projects []Project) time.Time {
+	var latest time.Time
+	for _, project := range projects {
+		t, err := time.Parse(time.RFC3339, project.LastBuildTime)
+		if err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
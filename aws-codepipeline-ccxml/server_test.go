@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFeedServer(t *testing.T) {
+	server := &FeedServer{}
+	handler := server.Handler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/cc.xml", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /cc.xml before the first refresh is %d not %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+
+	server.PersistProjects([]Project{
+		Project{Name: "prod :: service", Activity: ActivitySleeping, LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-01T00:00:00Z"},
+	})
+
+	for _, test := range []struct {
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/cc.xml", http.StatusOK, "application/xml", `<Project name="prod :: service"`},
+		{"/cc.json", http.StatusOK, "application/json", `"name":"prod :: service"`},
+		{"/badges/prod-service.svg", http.StatusOK, BadgeContentType, ">success</text>"},
+		{"/", http.StatusOK, DashboardContentType, "prod :: service"},
+		{"/badges/missing.svg", http.StatusNotFound, "", ""},
+		{"/missing", http.StatusNotFound, "", ""},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", test.path, nil))
+
+		if recorder.Code != test.code {
+			t.Errorf("GET %s is %d not %d", test.path, recorder.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		if recorder.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("GET %s Content-Type is %s not %s", test.path, recorder.Header().Get("Content-Type"), test.contentType)
+		}
+		if !strings.Contains(recorder.Body.String(), test.body) {
+			t.Errorf("GET %s does not contain %s: %s", test.path, test.body, recorder.Body.String())
+		}
+	}
+}
+
+func TestFeedServerRun(t *testing.T) {
+	stateProvider := &stubPipelineStateProvider{
+		pipelineStates: []PipelineState{PipelineState{Name: "service"}},
+	}
+	server := &FeedServer{stateProvider: stateProvider}
+
+	// a cancelled context still refreshes once before returning
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	server.Run(ctx)
+
+	projects, _ := server.ReadProjects()
+	if len(projects) != 1 || projects[0].Name != "service" {
+		t.Errorf("Run(...) refreshed %v not the service pipeline", projects)
+	}
+
+	status, _ := server.PersistProjects(projects)
+	if status != PersistStatusUnchanged {
+		t.Errorf("PersistProjects(...) of the same projects is %s not %s", status, PersistStatusUnchanged)
+	}
+}
+
+func TestFeedServerRefreshPartialFailure(t *testing.T) {
+	readErr := errors.New("AccessDeniedException")
+	stateProvider := &stubPipelineStateProvider{
+		pipelineStates: []PipelineState{
+			PipelineState{Name: "service"},
+			PipelineState{Name: "broken", Err: readErr},
+		},
+		err: &PartialError{[]*PipelineError{&PipelineError{"broken", readErr}}, 2},
+	}
+	server := &FeedServer{stateProvider: stateProvider}
+
+	server.Refresh()
+	projects, _ := server.ReadProjects()
+	if len(projects) != 2 {
+		t.Errorf("Refresh() served %d projects not 2", len(projects))
+	}
+	if server.refreshed.IsZero() {
+		t.Errorf("Refresh() did not record the refresh, so every request would refresh again")
+	}
+}
+
+func TestFeedServerConditionalGet(t *testing.T) {
+	server := &FeedServer{}
+	server.PersistProjects([]Project{
+		Project{Name: "service", LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-01T00:00:00Z"},
+		Project{Name: "website", LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-02T00:00:00Z"},
+	})
+	handler := server.Handler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/cc.xml", nil))
+	etag := recorder.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) {
+		t.Errorf("GET /cc.xml ETag is %s not a strong ETag", etag)
+	}
+	lastModified := recorder.Header().Get("Last-Modified")
+	if lastModified != server.changed.UTC().Format(http.TimeFormat) {
+		t.Errorf("GET /cc.xml Last-Modified is %s not when the projects changed", lastModified)
+	}
+
+	for _, test := range []struct {
+		header string
+		value  string
+		code   int
+	}{
+		{"If-None-Match", etag, http.StatusNotModified},
+		{"If-None-Match", `"stale"`, http.StatusOK},
+		{"If-Modified-Since", lastModified, http.StatusNotModified},
+		{"If-Modified-Since", "Wed, 02 Jan 2019 00:00:00 GMT", http.StatusOK},
+	} {
+		request := httptest.NewRequest("GET", "/cc.xml", nil)
+		request.Header.Set(test.header, test.value)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("GET /cc.xml with %s: %s is %d not %d", test.header, test.value, recorder.Code, test.code)
+		}
+		if test.code == http.StatusNotModified && recorder.Body.Len() > 0 {
+			t.Errorf("GET /cc.xml with %s: %s returned a body", test.header, test.value)
+		}
+	}
+
+	// a change to the projects changes the ETag
+	server.PersistProjects([]Project{Project{Name: "service", LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-01-01T00:00:00Z"}})
+	request := httptest.NewRequest("GET", "/cc.xml", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("GET /cc.xml with a stale ETag is %d not %d", recorder.Code, http.StatusOK)
+	}
+
+	// the website holding the newest build was removed, which is still a modification
+	request = httptest.NewRequest("GET", "/cc.xml", nil)
+	request.Header.Set("If-Modified-Since", "Wed, 02 Jan 2019 00:00:00 GMT")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("GET /cc.xml modified since the newest build is %d not %d", recorder.Code, http.StatusOK)
+	}
+}
+
+func TestFeedServerFilter(t *testing.T) {
+	server := &FeedServer{}
+	server.PersistProjects([]Project{
+		Project{Name: "payments-api", Pipeline: "payments-api", LastBuildStatus: LastBuildStatusFailure, LastBuildTime: "2019-01-01T00:00:00Z"},
+		Project{Name: "search", Pipeline: "search", LastBuildStatus: LastBuildStatusSuccess, LastBuildTime: "2019-01-01T00:00:00Z"},
+	})
+	handler := server.Handler()
+
+	for _, test := range []struct {
+		path     string
+		code     int
+		contains []string
+		excludes []string
+	}{
+		{"/cc.xml?pipeline=payments-*", http.StatusOK, []string{`"payments-api"`}, []string{`"search"`}},
+		{"/cc.json?status=success", http.StatusOK, []string{`"search"`}, []string{`"payments-api"`}},
+		{"/?status=Failure", http.StatusOK, []string{"payments-api"}, []string{"search"}},
+		{"/cc.xml", http.StatusOK, []string{`"payments-api"`, `"search"`}, nil},
+		{"/cc.xml?status=broken", http.StatusBadRequest, nil, nil},
+		{"/cc.xml?tag=team:payments", http.StatusBadRequest, nil, nil},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", test.path, nil))
+
+		if recorder.Code != test.code {
+			t.Errorf("GET %s is %d not %d", test.path, recorder.Code, test.code)
+			continue
+		}
+		for _, s := range test.contains {
+			if !strings.Contains(recorder.Body.String(), s) {
+				t.Errorf("GET %s does not contain %s: %s", test.path, s, recorder.Body.String())
+			}
+		}
+		for _, s := range test.excludes {
+			if strings.Contains(recorder.Body.String(), s) {
+				t.Errorf("GET %s contains %s: %s", test.path, s, recorder.Body.String())
+			}
+		}
+	}
+
+	// queries selecting the same projects share a cached response, until the projects change
+	if _, ok := server.responses["/cc.xml?"+(ProjectFilter{Pipelines: []string{"payments-*"}}).Key()]; !ok {
+		t.Errorf("GET /cc.xml?pipeline=payments-* was not cached: %v", server.responses)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/cc.xml?pipeline=payments-*&pipeline=payments-*", nil))
+	if len(server.responses) != 4 {
+		t.Errorf("GET /cc.xml with a repeated pattern cached %d responses not 4", len(server.responses))
+	}
+
+	server.PersistProjects([]Project{Project{Name: "payments-api", Pipeline: "payments-api", LastBuildStatus: LastBuildStatusSuccess}})
+	if len(server.responses) != 0 {
+		t.Errorf("PersistProjects(...) kept %d cached responses", len(server.responses))
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/cc.xml?pipeline=payments-*", nil))
+	if !strings.Contains(recorder.Body.String(), `lastBuildStatus="Success"`) {
+		t.Errorf("GET /cc.xml?pipeline=payments-* after the projects changed is %s", recorder.Body.String())
+	}
+
+	// tags can only be filtered on once they are read
+	server.tags = true
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/cc.xml?tag=team:payments", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("GET /cc.xml?tag=team:payments when tags are read is %d not %d", recorder.Code, http.StatusOK)
+	}
+}
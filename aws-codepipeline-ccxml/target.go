@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TargetPolicy decides whether a feed written to only some targets is a failure
+type TargetPolicy string
+
+const (
+	// TargetPolicyAll fails when the feed could not be written to any one of the targets
+	TargetPolicyAll TargetPolicy = "all"
+	// TargetPolicyBestEffort only fails when the feed could not be written to any target
+	TargetPolicyBestEffort TargetPolicy = "best-effort"
+)
+
+// TargetError records why the feed could not be written to a single target
+type TargetError struct {
+	Target string
+	Err    error
+}
+
+func (e *TargetError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Target, e.Err)
+}
+
+func (e *TargetError) Unwrap() error {
+	return e.Err
+}
+
+// MultiTargetError is returned when the feed could not be written to some or all of the targets
+type MultiTargetError struct {
+	Errs  []*TargetError
+	Total int
+}
+
+func (e *MultiTargetError) Error() string {
+	messages := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("unable to write %d of %d targets: %s", len(e.Errs), e.Total, strings.Join(messages, "; "))
+}
+
+func (e *MultiTargetError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// MultiPersistenceProvider persists the current project state to several targets at the same time
+type MultiPersistenceProvider struct {
+	providers []PersistenceProvider
+	policy    TargetPolicy
+}
+
+// PersistProjects to every target. Under TargetPolicyBestEffort a feed written to some targets
+// returns its status along with a *MultiTargetError recording the targets that failed
+func (p *MultiPersistenceProvider) PersistProjects(projects []Project) (PersistStatus, error) {
+	statuses, errs := persistTargets(p.providers, projects)
+	return p.result(statuses, errs)
+}
+
+// persistTargets writes the projects to each of the providers at the same time
+func persistTargets(providers []PersistenceProvider, projects []Project) ([]PersistStatus, []error) {
+	statuses := make([]PersistStatus, len(providers))
+	errs := make([]error, len(providers))
+
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider PersistenceProvider) {
+			defer wg.Done()
+			statuses[i], errs[i] = provider.PersistProjects(projects)
+		}(i, provider)
+	}
+	wg.Wait()
+	return statuses, errs
+}
+
+// result of writing to every target, in the order of the providers, under the policy
+func (p *MultiPersistenceProvider) result(statuses []PersistStatus, errs []error) (PersistStatus, error) {
+	status := PersistStatusUnchanged
+	failed := make([]*TargetError, 0)
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, &TargetError{targetName(p.providers[i]), err})
+		} else if statuses[i] == PersistStatusWritten {
+			status = PersistStatusWritten
+		}
+	}
+
+	if len(failed) == 0 {
+		return status, nil
+	}
+	err := &MultiTargetError{failed, len(p.providers)}
+	if p.policy == TargetPolicyBestEffort && len(failed) < len(p.providers) {
+		return status, err
+	}
+	return "", err
+}
+
+// VersionedMultiPersistenceProvider persists to several targets when the primary target, the first,
+// can be versioned. The version is that of the primary target, and the other targets are only written
+// once the primary target has been
+type VersionedMultiPersistenceProvider struct {
+	*MultiPersistenceProvider
+	primary VersionedPersistenceProvider
+}
+
+// newMultiPersistenceProvider persists to every one of the providers, versioned by the first when it can be
+func newMultiPersistenceProvider(providers []PersistenceProvider, policy TargetPolicy) PersistenceProvider {
+	multi := &MultiPersistenceProvider{providers, policy}
+	if primary, ok := providers[0].(VersionedPersistenceProvider); ok {
+		return &VersionedMultiPersistenceProvider{multi, primary}
+	}
+	return multi
+}
+
+// ReadProjectsVersion at the version of the primary target. The projects are read from a JSON target
+// when the primary target is not one, as it keeps the fields that the XML feed leaves out, unless the
+// JSON target cannot be read, such as when it has only just been added
+func (p *VersionedMultiPersistenceProvider) ReadProjectsVersion() ([]Project, string, error) {
+	projects, version, err := p.primary.ReadProjectsVersion()
+	if err != nil {
+		return projects, version, err
+	}
+
+	i, ok := p.jsonTarget()
+	if !ok || i == 0 {
+		return projects, version, nil
+	}
+	detailed, err := p.providers[i].(ProjectsReader).ReadProjects()
+	if err != nil {
+		return projects, version, nil
+	}
+	return detailed, version, nil
+}
+
+// PersistProjectsVersion to the primary target if it is unchanged since it was read, and then to every
+// other target. A conflict or failure writing the primary target writes none of the others
+func (p *VersionedMultiPersistenceProvider) PersistProjectsVersion(projects []Project, version string) (PersistStatus, error) {
+	status, err := p.primary.PersistProjectsVersion(projects, version)
+	if err != nil {
+		return "", &TargetError{targetName(p.providers[0]), err}
+	}
+
+	statuses, errs := persistTargets(p.providers[1:], projects)
+	return p.result(append([]PersistStatus{status}, statuses...), append([]error{nil}, errs...))
+}
+
+// formattedTarget is a target that knows the format of its feed
+type formattedTarget interface {
+	feedFormat() Format
+}
+
+// ReadProjects from the first target that can be read, which every target holds a copy of. A JSON
+// feed is preferred as it keeps the fields that the XML feed leaves out
+func (p *MultiPersistenceProvider) ReadProjects() ([]Project, error) {
+	if i, ok := p.jsonTarget(); ok {
+		return p.providers[i].(ProjectsReader).ReadProjects()
+	}
+
+	for _, provider := range p.providers {
+		if reader, ok := provider.(ProjectsReader); ok {
+			return reader.ReadProjects()
+		}
+	}
+	return nil, errors.New("no target can be read")
+}
+
+// jsonTarget is the index of the first target holding a JSON feed that can be read back
+func (p *MultiPersistenceProvider) jsonTarget() (int, bool) {
+	for i, provider := range p.providers {
+		_, readable := provider.(ProjectsReader)
+		target, formatted := provider.(formattedTarget)
+		if readable && formatted && target.feedFormat() == FormatJSON {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// targetName describes a target in errors
+func targetName(provider PersistenceProvider) string {
+	if s, ok := provider.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", provider)
+}
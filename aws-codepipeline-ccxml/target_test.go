@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+type stubTarget struct {
+	name    string
+	status  PersistStatus
+	err     error
+	written []Project
+}
+
+func (p *stubTarget) PersistProjects(projects []Project) (PersistStatus, error) {
+	p.written = projects
+	return p.status, p.err
+}
+
+func (p *stubTarget) String() string {
+	return p.name
+}
+
+func TestMultiPersistenceProvider(t *testing.T) {
+	projects := []Project{Project{Name: "test-project"}}
+	writeErr := errors.New("AccessDenied")
+
+	for _, test := range []struct {
+		name     string
+		policy   TargetPolicy
+		targets  []*stubTarget
+		expected PersistStatus
+		failed   int
+	}{
+		{
+			name:   "all written",
+			policy: TargetPolicyAll,
+			targets: []*stubTarget{
+				&stubTarget{name: "a", status: PersistStatusUnchanged},
+				&stubTarget{name: "b", status: PersistStatusWritten},
+			},
+			expected: PersistStatusWritten,
+		},
+		{
+			name:   "all unchanged",
+			policy: TargetPolicyAll,
+			targets: []*stubTarget{
+				&stubTarget{name: "a", status: PersistStatusUnchanged},
+				&stubTarget{name: "b", status: PersistStatusUnchanged},
+			},
+			expected: PersistStatusUnchanged,
+		},
+		{
+			name:   "one failed",
+			policy: TargetPolicyAll,
+			targets: []*stubTarget{
+				&stubTarget{name: "a", status: PersistStatusWritten},
+				&stubTarget{name: "b", err: writeErr},
+			},
+			failed: 1,
+		},
+		{
+			name:   "one failed with best effort",
+			policy: TargetPolicyBestEffort,
+			targets: []*stubTarget{
+				&stubTarget{name: "a", status: PersistStatusWritten},
+				&stubTarget{name: "b", err: writeErr},
+			},
+			expected: PersistStatusWritten,
+			failed:   1,
+		},
+		{
+			name:   "every one failed with best effort",
+			policy: TargetPolicyBestEffort,
+			targets: []*stubTarget{
+				&stubTarget{name: "a", err: writeErr},
+				&stubTarget{name: "b", err: writeErr},
+			},
+			failed: 2,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			providers := make([]PersistenceProvider, 0, len(test.targets))
+			for _, target := range test.targets {
+				providers = append(providers, target)
+			}
+			provider := MultiPersistenceProvider{providers, test.policy}
+
+			status, err := provider.PersistProjects(projects)
+			if status != test.expected {
+				t.Errorf("PersistProjects(...) status is %q not %q", status, test.expected)
+			}
+
+			var targetErr *MultiTargetError
+			if test.failed == 0 && err != nil {
+				t.Errorf("PersistProjects(...) returned %v", err)
+			}
+			if test.failed > 0 {
+				if !errors.As(err, &targetErr) || len(targetErr.Errs) != test.failed || targetErr.Total != len(test.targets) {
+					t.Fatalf("PersistProjects(...) returned %v not %d failed targets", err, test.failed)
+				}
+				if !errors.Is(err, writeErr) {
+					t.Errorf("PersistProjects(...) returned %v not the write error", err)
+				}
+				if targetErr.Errs[0].Target != "a" && targetErr.Errs[0].Target != "b" {
+					t.Errorf("PersistProjects(...) failed target is %s", targetErr.Errs[0].Target)
+				}
+			}
+
+			for _, target := range test.targets {
+				if len(target.written) != len(projects) {
+					t.Errorf("PersistProjects(...) wrote %d projects to %s not %d", len(target.written), target.name, len(projects))
+				}
+			}
+		})
+	}
+}
+
+func TestVersionedMultiPersistenceProvider(t *testing.T) {
+	projects := []Project{Project{Name: "test-project"}}
+	primary := &versionedPersistenceProvider{version: 1, conflicts: 1}
+	other := &stubTarget{name: "other", status: PersistStatusWritten}
+
+	provider, ok := newMultiPersistenceProvider([]PersistenceProvider{primary, other}, TargetPolicyAll).(VersionedPersistenceProvider)
+	if !ok {
+		t.Fatalf("newMultiPersistenceProvider(...) cannot be versioned when its primary target can be")
+	}
+
+	_, version, err := provider.ReadProjectsVersion()
+	if err != nil || version != "1" {
+		t.Fatalf("ReadProjectsVersion() is %q %v not the version of the primary target", version, err)
+	}
+
+	_, err = provider.PersistProjectsVersion(projects, version)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("PersistProjectsVersion(...) returned %v not %v", err, ErrVersionConflict)
+	}
+	if other.written != nil {
+		t.Errorf("PersistProjectsVersion(...) wrote the other targets when the primary target conflicted")
+	}
+
+	_, version, _ = provider.ReadProjectsVersion()
+	status, err := provider.PersistProjectsVersion(projects, version)
+	if err != nil || status != PersistStatusWritten {
+		t.Fatalf("PersistProjectsVersion(...) is %s %v", status, err)
+	}
+	if len(primary.projects) != len(projects) || len(other.written) != len(projects) {
+		t.Errorf("PersistProjectsVersion(...) did not write every target")
+	}
+
+	if _, ok := newMultiPersistenceProvider([]PersistenceProvider{other, primary}, TargetPolicyAll).(VersionedPersistenceProvider); ok {
+		t.Errorf("newMultiPersistenceProvider(...) can be versioned when its primary target cannot be")
+	}
+}
+
+func TestVersionedMultiPersistenceProviderReadsJSON(t *testing.T) {
+	primary := &versionedPersistenceProvider{
+		version:                      1,
+		recordingPersistenceProvider: recordingPersistenceProvider{existing: []Project{Project{Name: "a"}}},
+	}
+	detailed := &FilePersistenceProvider{filepath.Join(t.TempDir(), "cc.json"), FormatJSON, false, false}
+	provider := newMultiPersistenceProvider([]PersistenceProvider{primary, detailed}, TargetPolicyAll).(VersionedPersistenceProvider)
+
+	// a JSON target that has not been written yet leaves the projects to the primary target
+	projects, version, err := provider.ReadProjectsVersion()
+	if err != nil || version != "1" || len(projects) != 1 || projects[0].Pipeline != "" {
+		t.Fatalf("ReadProjectsVersion() is %v %q %v not the primary target", projects, version, err)
+	}
+
+	_, err = detailed.PersistProjects([]Project{Project{Name: "a", Pipeline: "a", Region: "eu-west-1"}})
+	if err != nil {
+		t.Fatalf("failed to persist projects: %v", err)
+	}
+	projects, version, err = provider.ReadProjectsVersion()
+	if err != nil || version != "1" {
+		t.Fatalf("ReadProjectsVersion() is %q %v not the version of the primary target", version, err)
+	}
+	if len(projects) != 1 || projects[0].Pipeline != "a" || projects[0].Region != "eu-west-1" {
+		t.Errorf("ReadProjectsVersion() is %+v not the projects of the JSON target", projects)
+	}
+}
@@ -12,11 +12,28 @@ terraform {
 }
 
 locals {
-  lambda_src_path = "${path.module}/aws-codepipeline-ccxml"
-  binary_path     = "${path.module}/dist"
+  lambda_src_path   = "${path.module}/aws-codepipeline-ccxml"
+  binary_path       = "${path.module}/dist"
+  presign_parameter = coalesce(var.presign_parameter, "/${var.function_name}/feed-url")
+  feed_environment = {
+    REGIONS              = join(",", var.regions)
+    REGION_NAMING        = var.region_naming
+    ROLES                = join(",", [for role in var.roles : role.alias == "" ? role.arn : "${role.alias}=${role.arn}"])
+    EXTERNAL_ID          = var.external_id
+    ACCOUNT_NAMING       = var.account_naming
+    CONCURRENCY          = var.concurrency
+    PIPELINE_TAGS        = var.pipeline_tags
+    GRANULARITY          = var.granularity
+    SEPARATOR            = var.separator
+    DISABLED_TRANSITIONS = var.disabled_transitions
+  }
   event_pattern = {
     source      = ["aws.codepipeline"]
-    detail-type = ["CodePipeline Stage Execution State Change"]
+    detail-type = [
+      "CodePipeline Pipeline Execution State Change",
+      "CodePipeline Stage Execution State Change",
+      "CodePipeline Action Execution State Change",
+    ]
   }
 }
 
@@ -28,10 +45,10 @@ resource "aws_s3_bucket" "ccxml" {
 resource "aws_s3_bucket_public_access_block" "ccxml" {
   bucket = aws_s3_bucket.ccxml.id
 
-  block_public_acls       = false
-  block_public_policy     = false
-  ignore_public_acls      = false
-  restrict_public_buckets = false
+  block_public_acls       = var.private
+  block_public_policy     = var.private
+  ignore_public_acls      = var.private
+  restrict_public_buckets = var.private
 }
 
 resource "aws_s3_bucket_ownership_controls" "ccxml" {
@@ -42,6 +59,8 @@ resource "aws_s3_bucket_ownership_controls" "ccxml" {
 }
 
 resource "aws_s3_bucket_acl" "ccxml" {
+  count = var.private ? 0 : 1
+
   depends_on = [
     aws_s3_bucket_public_access_block.ccxml,
     aws_s3_bucket_ownership_controls.ccxml,
@@ -52,6 +71,7 @@ resource "aws_s3_bucket_acl" "ccxml" {
 }
 
 resource "aws_s3_bucket_website_configuration" "ccxml" {
+  count  = var.private ? 0 : 1
   bucket = aws_s3_bucket.ccxml.id
 
   index_document {
@@ -90,13 +110,73 @@ resource "aws_lambda_function" "ccxml" {
   tags            = var.tags
 
   environment {
-    variables = {
-      BUCKET = var.bucket
-      KEY    = var.key
-    }
+    variables = merge({
+      BUCKET          = var.bucket
+      KEY             = var.key
+      TARGETS         = join(",", var.targets)
+      TARGET_POLICY   = var.target_policy
+      BADGE_PREFIX    = var.badge_prefix
+      DASHBOARD       = var.dashboard
+      ATOM            = var.atom
+      ATOM_ENTRIES    = var.atom_entries
+      PRIVATE           = var.private
+      PRESIGN_EXPIRY    = var.presign_expiry
+      PRESIGN_PARAMETER = var.private ? local.presign_parameter : ""
+      CONTENT_TYPE      = var.content_type
+      CACHE_CONTROL     = var.cache_control
+      SSE               = var.sse
+      SSE_KMS_KEY_ID    = var.sse_kms_key_id
+      STORAGE_CLASS     = var.storage_class
+      OBJECT_TAGS       = join(",", [for k, v in var.object_tags : "${k}=${v}"])
+      OBJECT_METADATA   = join(",", [for k, v in var.object_metadata : "${k}=${v}"])
+      GZIP              = var.gzip
+    }, local.feed_environment)
   }
 }
 
+resource "aws_lambda_function" "feed" {
+  count = var.function_url ? 1 : 0
+
+  filename         = data.archive_file.lambda_zip.output_path
+  function_name    = "${var.function_name}-feed"
+  handler          = "bootstrap"
+  description      = "Handler that serves the CCTray XML feed from a Function URL"
+  memory_size      = var.memory_size
+  timeout          = var.timeout
+  runtime          = "provided.al2"
+  source_code_hash = data.archive_file.lambda_zip.output_base64sha256
+  role             = aws_iam_role.ccxml.arn
+  tags             = var.tags
+
+  environment {
+    variables = merge({
+      HANDLER       = "function-url"
+      REFRESH       = var.function_url_refresh
+      BASIC_AUTH    = join(",", var.function_url_basic_auth)
+      BEARER_TOKENS = join(",", var.function_url_bearer_tokens)
+      ALLOW_CIDRS   = join(",", var.function_url_allow_cidrs)
+    }, local.feed_environment)
+  }
+}
+
+resource "aws_lambda_function_url" "feed" {
+  count = var.function_url ? 1 : 0
+
+  function_name      = aws_lambda_function.feed[0].function_name
+  authorization_type = var.function_url_authorization
+}
+
+# a Function URL created through the API has no policy letting anyone invoke it, unlike one created in the
+# console. With AWS_IAM the callers are granted it through their own IAM policies instead
+resource "aws_lambda_permission" "feed" {
+  count                  = var.function_url && var.function_url_authorization == "NONE" ? 1 : 0
+  statement_id           = "AllowPublicFunctionURL"
+  action                 = "lambda:InvokeFunctionUrl"
+  function_name          = aws_lambda_function.feed[0].function_name
+  principal              = "*"
+  function_url_auth_type = var.function_url_authorization
+}
+
 data "aws_iam_policy_document" "ccxml_assume_role_policy" {
   statement {
     effect  = "Allow"
@@ -124,6 +204,7 @@ data "aws_iam_policy_document" "ccxml_role_policy" {
     actions = [
       "codepipeline:ListPipelines",
       "codepipeline:GetPipelineState",
+      "codepipeline:ListActionExecutions",
     ]
     resources = ["*"]
   }
@@ -131,12 +212,89 @@ data "aws_iam_policy_document" "ccxml_role_policy" {
   statement {
     effect = "Allow"
     actions = [
+      "s3:GetObject",
       "s3:PutObject",
       "s3:PutObjectAcl",
     ]
-    resources = [
-      "arn:aws:s3:::${var.bucket}/${var.key}",
-    ]
+    resources = concat(
+      ["arn:aws:s3:::${var.bucket}/${var.key}"],
+      [for target in var.targets : "arn:aws:s3:::${trimprefix(target, "s3://")}"],
+      var.badge_prefix == "" ? [] : ["arn:aws:s3:::${var.bucket}/${var.badge_prefix}*"],
+      var.dashboard == "" ? [] : ["arn:aws:s3:::${var.bucket}/${var.dashboard}"],
+      var.atom == "" ? [] : ["arn:aws:s3:::${var.bucket}/${var.atom}"],
+    )
+  }
+
+  # S3 only reports an object as missing, rather than denying it, to those who can list the bucket
+  statement {
+    effect  = "Allow"
+    actions = ["s3:ListBucket"]
+    resources = distinct(concat(
+      ["arn:aws:s3:::${var.bucket}"],
+      [for target in var.targets : "arn:aws:s3:::${split("/", trimprefix(target, "s3://"))[0]}"],
+    ))
+  }
+
+  dynamic "statement" {
+    for_each = length(var.object_tags) > 0 ? [1] : []
+
+    content {
+      effect  = "Allow"
+      actions = ["s3:PutObjectTagging"]
+      resources = concat(
+        ["arn:aws:s3:::${var.bucket}/${var.key}"],
+        [for target in var.targets : "arn:aws:s3:::${trimprefix(target, "s3://")}"],
+        var.badge_prefix == "" ? [] : ["arn:aws:s3:::${var.bucket}/${var.badge_prefix}*"],
+        var.dashboard == "" ? [] : ["arn:aws:s3:::${var.bucket}/${var.dashboard}"],
+        var.atom == "" ? [] : ["arn:aws:s3:::${var.bucket}/${var.atom}"],
+      )
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.pipeline_tags ? [1] : []
+
+    content {
+      effect = "Allow"
+      actions = [
+        "codepipeline:GetPipeline",
+        "codepipeline:ListTagsForResource",
+      ]
+      resources = ["*"]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.sse_kms_key_id != "" ? [1] : []
+
+    content {
+      effect = "Allow"
+      actions = [
+        "kms:GenerateDataKey",
+        "kms:Decrypt",
+      ]
+      resources = [var.sse_kms_key_id]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.private ? [1] : []
+
+    content {
+      effect    = "Allow"
+      actions   = ["ssm:PutParameter"]
+      resources = [aws_ssm_parameter.presign[0].arn]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = length(var.roles) > 0 ? [1] : []
+
+    content {
+      effect    = "Allow"
+      actions   = ["sts:AssumeRole"]
+      resources = [for role in var.roles : role.arn]
+    }
   }
 
   statement {
@@ -146,9 +304,10 @@ data "aws_iam_policy_document" "ccxml_role_policy" {
       "logs:CreateLogStream",
       "logs:PutLogEvents",
     ]
-    resources = [
-      "arn:aws:logs:*:*:log-group:/aws/lambda/${var.function_name}:*",
-    ]
+    resources = concat(
+      ["arn:aws:logs:*:*:log-group:/aws/lambda/${var.function_name}:*"],
+      var.function_url ? ["arn:aws:logs:*:*:log-group:/aws/lambda/${var.function_name}-feed:*"] : [],
+    )
   }
 }
 
@@ -159,7 +318,7 @@ resource "aws_iam_role_policy" "ccxml" {
 
 resource "aws_cloudwatch_event_rule" "ccxml" {
   name        = var.function_name
-  description = "Rule that matches CodePipeline State Execution State Changes"
+  description = "Rule that matches CodePipeline Pipeline, Stage and Action Execution State Changes"
   tags        = var.tags
 
   event_pattern = jsonencode(local.event_pattern)
@@ -179,6 +338,68 @@ resource "aws_lambda_permission" "ccxml" {
   source_arn    = aws_cloudwatch_event_rule.ccxml.arn
 }
 
+resource "aws_cloudwatch_event_rule" "rebuild" {
+  count               = var.rebuild_schedule == "" ? 0 : 1
+  name                = "${var.function_name}-rebuild"
+  description         = "Rule that rebuilds the feed from every pipeline, including those in other regions and accounts"
+  schedule_expression = var.rebuild_schedule
+  tags                = var.tags
+}
+
+resource "aws_cloudwatch_event_target" "rebuild" {
+  count     = var.rebuild_schedule == "" ? 0 : 1
+  target_id = "${var.function_name}-rebuild"
+  rule      = aws_cloudwatch_event_rule.rebuild[0].name
+  arn       = aws_lambda_function.ccxml.arn
+}
+
+resource "aws_lambda_permission" "rebuild" {
+  count         = var.rebuild_schedule == "" ? 0 : 1
+  statement_id  = "AllowRebuildFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.ccxml.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.rebuild[0].arn
+}
+
+# the Lambda writes the pre-signed URL here, so only the parameter itself is managed
+resource "aws_ssm_parameter" "presign" {
+  count       = var.private ? 1 : 0
+  name        = local.presign_parameter
+  description = "The pre-signed URL to the private CCTray XML feed, rotated on a schedule"
+  type        = "SecureString"
+  value       = "pending"
+  tags        = var.tags
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+}
+
+resource "aws_cloudwatch_event_rule" "presign" {
+  count               = var.private ? 1 : 0
+  name                = "${var.function_name}-presign"
+  description         = "Rule that rotates the pre-signed URL of the private feed"
+  schedule_expression = var.presign_schedule
+  tags                = var.tags
+}
+
+resource "aws_cloudwatch_event_target" "presign" {
+  count     = var.private ? 1 : 0
+  target_id = "${var.function_name}-presign"
+  rule      = aws_cloudwatch_event_rule.presign[0].name
+  arn       = aws_lambda_function.ccxml.arn
+}
+
+resource "aws_lambda_permission" "presign" {
+  count         = var.private ? 1 : 0
+  statement_id  = "AllowPresignFromCloudWatch"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.ccxml.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.presign[0].arn
+}
+
 output "website" {
-  value = "http://${aws_s3_bucket_website_configuration.ccxml.website_endpoint}/${var.key}"
+  value = var.private ? null : "http://${aws_s3_bucket_website_configuration.ccxml[0].website_endpoint}/${var.key}"
 }
@@ -1,6 +1,26 @@
 output "website_url" {
-  description = "The URL of the CCTray XML feed"
-  value       = "http://${aws_s3_bucket_website_configuration.ccxml.website_endpoint}/${var.key}"
+  description = "The URL of the CCTray XML feed, unless the feed is private"
+  value       = var.private ? null : "http://${aws_s3_bucket_website_configuration.ccxml[0].website_endpoint}/${var.key}"
+}
+
+output "dashboard_url" {
+  description = "The URL of the HTML dashboard, unless the feed is private or there is no dashboard"
+  value       = var.private || var.dashboard == "" ? null : "http://${aws_s3_bucket_website_configuration.ccxml[0].website_endpoint}/${var.dashboard}"
+}
+
+output "atom_url" {
+  description = "The URL of the Atom feed of transitions, unless the feed is private or there is no Atom feed"
+  value       = var.private || var.atom == "" ? null : "http://${aws_s3_bucket_website_configuration.ccxml[0].website_endpoint}/${var.atom}"
+}
+
+output "presign_parameter" {
+  description = "The SSM parameter holding the current pre-signed URL to the feed, when the feed is private"
+  value       = var.private ? aws_ssm_parameter.presign[0].name : null
+}
+
+output "function_url" {
+  description = "The Function URL that serves the feed, unless there is none"
+  value       = var.function_url ? aws_lambda_function_url.feed[0].function_url : null
 }
 
 output "lambda_function_arn" {
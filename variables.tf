@@ -32,3 +32,218 @@ variable "tags" {
   type        = map(string)
   default     = {}
 }
+
+variable "granularity" {
+  description = "Report a project per pipeline, stage or action (pipeline, stage or action)"
+  type        = string
+  default     = "pipeline"
+}
+
+variable "separator" {
+  description = "The separator placed between pipeline, stage and action names"
+  type        = string
+  default     = " :: "
+}
+
+variable "disabled_transitions" {
+  description = "How to report stages behind a disabled transition (ignore or unknown)"
+  type        = string
+  default     = "unknown"
+}
+
+variable "concurrency" {
+  description = "The number of pipelines whose state is fetched at the same time"
+  type        = number
+  default     = 10
+}
+
+variable "pipeline_tags" {
+  description = "Read the tags of each pipeline, which are published in the JSON feed and can filter the served feed"
+  type        = bool
+  default     = false
+}
+
+variable "regions" {
+  description = "The regions to report on, defaulting to the region of the Lambda function"
+  type        = list(string)
+  default     = []
+}
+
+variable "region_naming" {
+  description = "Where to place the region in project names (none, prefix or suffix)"
+  type        = string
+  default     = "none"
+}
+
+variable "roles" {
+  description = "Roles to assume to report on pipelines in other accounts, with an optional alias used in project names"
+  type = list(object({
+    arn   = string
+    alias = optional(string, "")
+  }))
+  default = []
+}
+
+variable "external_id" {
+  description = "The external ID used when assuming roles"
+  type        = string
+  default     = ""
+}
+
+variable "account_naming" {
+  description = "Where to place the account in project names (none, prefix or suffix)"
+  type        = string
+  default     = "prefix"
+}
+
+variable "private" {
+  description = "Keep the bucket private and publish a pre-signed URL to the feed instead of an S3 website"
+  type        = bool
+  default     = false
+}
+
+variable "presign_expiry" {
+  description = "How long the pre-signed URL to a private feed is valid for"
+  type        = string
+  default     = "12h"
+}
+
+variable "presign_parameter" {
+  description = "The SSM parameter the pre-signed URL to a private feed is written to, defaulting to /<function_name>/feed-url"
+  type        = string
+  default     = null
+}
+
+variable "rebuild_schedule" {
+  description = "The schedule on which the feed is rebuilt from every pipeline, which is the only way pipelines in other regions and accounts are refreshed, or empty for none"
+  type        = string
+  default     = "rate(15 minutes)"
+}
+
+variable "presign_schedule" {
+  description = "The schedule on which the pre-signed URL to a private feed is rotated"
+  type        = string
+  default     = "rate(6 hours)"
+}
+
+variable "content_type" {
+  description = "The Content-Type of the feed object, defaulting to that of the format of the feed"
+  type        = string
+  default     = ""
+}
+
+variable "cache_control" {
+  description = "The Cache-Control of the feed object, such as max-age=60"
+  type        = string
+  default     = ""
+}
+
+variable "sse" {
+  description = "The server-side encryption of the feed object (default, AES256 or aws:kms)"
+  type        = string
+  default     = "default"
+}
+
+variable "sse_kms_key_id" {
+  description = "The ARN of the KMS key used to encrypt the feed object when using aws:kms"
+  type        = string
+  default     = ""
+}
+
+variable "storage_class" {
+  description = "The storage class of the feed object, such as STANDARD or INTELLIGENT_TIERING, defaulting to STANDARD"
+  type        = string
+  default     = ""
+}
+
+variable "object_tags" {
+  description = "Tags to add to the feed object"
+  type        = map(string)
+  default     = {}
+}
+
+variable "object_metadata" {
+  description = "Metadata to add to the feed object"
+  type        = map(string)
+  default     = {}
+}
+
+variable "gzip" {
+  description = "Compress the feed object with gzip and set its Content-Encoding"
+  type        = bool
+  default     = false
+}
+
+variable "targets" {
+  description = "Further s3://bucket/key URLs to also write the feed to"
+  type        = list(string)
+  default     = []
+}
+
+variable "target_policy" {
+  description = "Fail when the feed could not be written to any one target (all) or only when it could not be written to every target (best-effort)"
+  type        = string
+  default     = "all"
+}
+
+variable "badge_prefix" {
+  description = "Write an SVG status badge for each project under this prefix of the bucket, such as badges/"
+  type        = string
+  default     = ""
+}
+
+variable "dashboard" {
+  description = "Write an HTML dashboard of the projects to this key of the bucket, such as index.html"
+  type        = string
+  default     = ""
+}
+
+variable "atom" {
+  description = "Write an Atom feed of projects that were broken, fixed or are still failing to this key of the bucket, such as transitions.atom"
+  type        = string
+  default     = ""
+}
+
+variable "atom_entries" {
+  description = "The number of transitions kept in the Atom feed"
+  type        = number
+  default     = 50
+}
+
+variable "function_url" {
+  description = "Also create a Lambda function that serves the feed from a Function URL"
+  type        = bool
+  default     = false
+}
+
+variable "function_url_authorization" {
+  description = "The authorization of the Function URL (NONE or AWS_IAM)"
+  type        = string
+  default     = "NONE"
+}
+
+variable "function_url_refresh" {
+  description = "How often the Function URL reads the state of the pipelines, with requests in between served from the last state read"
+  type        = string
+  default     = "1m"
+}
+
+variable "function_url_basic_auth" {
+  description = "The username:password credentials the Function URL accepts with HTTP basic authentication"
+  type        = list(string)
+  default     = []
+  sensitive   = true
+}
+
+variable "function_url_bearer_tokens" {
+  description = "The bearer tokens the Function URL accepts"
+  type        = list(string)
+  default     = []
+  sensitive   = true
+}
+
+variable "function_url_allow_cidrs" {
+  description = "The networks the Function URL accepts requests from, accepting requests from anywhere when empty"
+  type        = list(string)
+  default     = []
+}